@@ -20,6 +20,8 @@ import (
 	"math"
 	"sync"
 	"time"
+
+	"github.com/pinterest/bender/hist"
 )
 
 // An IntervalGenerator is a function that takes the current Unix epoch time
@@ -45,6 +47,13 @@ type RequestExecutor func(int64, interface{}) (interface{}, error)
 type StartEvent struct {
 	// The Unix epoch time in nanoseconds at which the load test started.
 	Start int64
+	// Aggregated is set if the load test aggregates the latencies of all its requests in
+	// HistogramEvents, in which case the EndRequestEvents may be sampled, and recorders that compute
+	// statistics should use the HistogramEvents instead. See WithAggregation.
+	Aggregated bool
+	// If Aggregated is set, Hist is an empty histogram with the bucketing of the HistogramEvents, so
+	// that recorders can check that they can merge them at the start of the load test.
+	Hist *hist.Histogram
 }
 
 // EndEvent is sent once at the end of the load test, after which no more events are sent.
@@ -58,6 +67,8 @@ type WaitEvent struct {
 	// The next wait time (in nanoseconds) and the accumulated overage time (the difference between
 	// the actual wait time and the intended wait time).
 	Wait, Overage int64
+	// The Unix epoch time (in nanoseconds) at which this event was created.
+	Time int64
 }
 
 // StartRequestEvent is sent before a request is executed. The sending of this event happens before
@@ -75,43 +86,74 @@ type StartRequestEvent struct {
 type EndRequestEvent struct {
 	// The Unix epoch times (in nanoseconds) at which the request was started and finished
 	Start, End int64
+	// The request that was sent
+	Request interface{}
 	// The response data returned by the request executor
 	Response interface{}
 	// An error or nil if there was no error
 	Err error
+	// The tags of the request, like the target host, and the durations of its phases, like the DNS
+	// lookup, if the request executor returned a TaggedResponse.
+	Tags   map[string]string
+	Phases map[string]time.Duration
+}
+
+// newEndRequestEvent creates the EndRequestEvent for a request, unwrapping a TaggedResponse.
+func newEndRequestEvent(start, end int64, req, res interface{}, err error) *EndRequestEvent {
+	e := &EndRequestEvent{Start: start, End: end, Request: req, Response: res, Err: err}
+	if tr, ok := res.(*TaggedResponse); ok {
+		e.Response, e.Tags, e.Phases = tr.Response, tr.Tags, tr.Phases
+	}
+	return e
 }
 
 // LoadTestThroughput starts a load test in which the caller controls the interval between requests
-// being sent. See the package documentation for details on the arguments to this function.
-func LoadTestThroughput(intervals IntervalGenerator, requests chan interface{}, requestExec RequestExecutor, recorder chan interface{}) {
+// being sent. See the package documentation for details on the arguments to this function, and the
+// Option functions for the optional settings.
+func LoadTestThroughput(intervals IntervalGenerator, requests chan interface{}, requestExec RequestExecutor, recorder chan interface{}, opts ...Option) {
+	o := newOptions(opts)
 	go func() {
 		start := time.Now().UnixNano()
-		recorder <- &StartEvent{start}
+		agg := o.aggregator(start, aggregatorShards())
+		recorder <- agg.startEvent(start)
+		agg.run(o.interval, recorder)
 
 		var wg sync.WaitGroup
 		var overage int64
+		waits, reqs := sampler{rate: o.waitRate}, sampler{rate: o.requestRate}
+		n := 0
 		overageStart := time.Now().UnixNano()
 		for request := range requests {
 			wait := intervals(overageStart)
 			adjust := int64(math.Min(float64(wait), float64(overage)))
 			wait -= adjust
 			overage -= adjust
-			recorder <- &WaitEvent{wait, overage}
+			if waits.sample() {
+				recorder <- &WaitEvent{wait, overage, time.Now().UnixNano()}
+			}
 			time.Sleep(time.Duration(wait))
 
 			wg.Add(1)
-			go func(req interface{}) {
+			go func(req interface{}, shard int, sampled bool) {
 				defer wg.Done()
-				recorder <- &StartRequestEvent{time.Now().UnixNano(), req}
+				if sampled {
+					recorder <- &StartRequestEvent{time.Now().UnixNano(), req}
+				}
 				reqStart := time.Now().UnixNano()
 				res, err := requestExec(time.Now().UnixNano(), req)
-				recorder <- &EndRequestEvent{reqStart, time.Now().UnixNano(), res, err}
-			}(request)
+				reqEnd := time.Now().UnixNano()
+				agg.add(shard, reqStart, reqEnd, err)
+				if sampled {
+					recorder <- newEndRequestEvent(reqStart, reqEnd, req, res, err)
+				}
+			}(request, n, reqs.sample())
+			n++
 
 			overage += time.Now().UnixNano() - overageStart - wait
 			overageStart = time.Now().UnixNano()
 		}
 		wg.Wait()
+		agg.close(recorder)
 		recorder <- &EndEvent{start, time.Now().UnixNano()}
 		close(recorder)
 	}()
@@ -151,31 +193,119 @@ func (s WorkerSemaphore) Wait(n int) bool {
 
 // LoadTestConcurrency starts a load test in which the caller controls the number of goroutines that
 // are sending requests. See the package documentation for details on the arguments to this
-// function.
-func LoadTestConcurrency(workers *WorkerSemaphore, requests chan interface{}, requestExec RequestExecutor, recorder chan interface{}) {
+// function, and the Option functions for the optional settings.
+func LoadTestConcurrency(workers *WorkerSemaphore, requests chan interface{}, requestExec RequestExecutor, recorder chan interface{}, opts ...Option) {
+	o := newOptions(opts)
 	go func() {
 		start := time.Now().UnixNano()
-		recorder <- &StartEvent{start}
+		agg := o.aggregator(start, aggregatorShards())
+		recorder <- agg.startEvent(start)
+		agg.run(o.interval, recorder)
 
 		var wg sync.WaitGroup
+		reqs := sampler{rate: o.requestRate}
+		n := 0
 		for request := range requests {
 			workers.Wait(1)
 
 			wg.Add(1)
-			go func(req interface{}) {
+			go func(req interface{}, shard int, sampled bool) {
 				defer func() {
 					wg.Done()
 					workers.Signal(1)
 				}()
 
 				reqStart := time.Now().UnixNano()
-				recorder <- &StartRequestEvent{start, req}
+				if sampled {
+					recorder <- &StartRequestEvent{start, req}
+				}
 				res, err := requestExec(time.Now().UnixNano(), req)
-				recorder <- &EndRequestEvent{reqStart, time.Now().UnixNano(), res, err}
-			}(request)
+				reqEnd := time.Now().UnixNano()
+				agg.add(shard, reqStart, reqEnd, err)
+				if sampled {
+					recorder <- newEndRequestEvent(reqStart, reqEnd, req, res, err)
+				}
+			}(request, n, reqs.sample())
+			n++
+		}
+
+		wg.Wait()
+		agg.close(recorder)
+		recorder <- &EndEvent{start, time.Now().UnixNano()}
+		close(recorder)
+	}()
+}
+
+// UserEndEvent is sent by LoadTestVirtualUsers when a virtual user stops, because the request
+// channel has been closed.
+type UserEndEvent struct {
+	// The index of the virtual user, from zero to the number of users.
+	User int
+	// The number of iterations (requests) completed by the user.
+	Iterations int
+	// The Unix epoch times in nanoseconds at which the user started and stopped.
+	Start, End int64
+}
+
+// LoadTestVirtualUsers starts a closed-loop load test with a fixed number of virtual users, each of
+// which sends a request, waits for the response, sleeps for a think time and then repeats. The think
+// time is drawn from the think IntervalGenerator, and the pace IntervalGenerator sets the minimum
+// time between the starts of consecutive iterations for each user, so it can be used to pace users
+// to a target iteration rate. Either generator may be nil to disable think time or pacing. A
+// UserEndEvent with the user's iteration count is sent as each user stops. See the package
+// documentation for details on the other arguments to this function, and the Option functions for
+// the optional settings.
+func LoadTestVirtualUsers(users int, think, pace IntervalGenerator, requests chan interface{}, requestExec RequestExecutor, recorder chan interface{}, opts ...Option) {
+	o := newOptions(opts)
+	go func() {
+		start := time.Now().UnixNano()
+		agg := o.aggregator(start, users)
+		recorder <- agg.startEvent(start)
+		agg.run(o.interval, recorder)
+
+		var wg sync.WaitGroup
+		for u := 0; u < users; u++ {
+			wg.Add(1)
+			go func(user int) {
+				defer wg.Done()
+				userStart := time.Now().UnixNano()
+				iterations := 0
+				reqs := sampler{rate: o.requestRate}
+				for request := range requests {
+					iterStart := time.Now().UnixNano()
+					sampled := reqs.sample()
+					if sampled {
+						recorder <- &StartRequestEvent{iterStart, request}
+					}
+					reqStart := time.Now().UnixNano()
+					res, err := requestExec(reqStart, request)
+					reqEnd := time.Now().UnixNano()
+					agg.add(user, reqStart, reqEnd, err)
+					if sampled {
+						recorder <- newEndRequestEvent(reqStart, reqEnd, request, res, err)
+					}
+					iterations++
+
+					// Sleep before taking the next request, so that requests aren't held by
+					// sleeping users while other users are ready to send them.
+					var wait int64
+					if think != nil {
+						wait = think(time.Now().UnixNano())
+					}
+					if pace != nil {
+						elapsed := time.Now().UnixNano() - iterStart
+						if remaining := pace(iterStart) - elapsed; remaining > wait {
+							wait = remaining
+						}
+					}
+					time.Sleep(time.Duration(wait))
+				}
+				recorder <- &UserEndEvent{user, iterations, userStart, time.Now().UnixNano()}
+			}(u)
 		}
 
 		wg.Wait()
+		agg.close(recorder)
 		recorder <- &EndEvent{start, time.Now().UnixNano()}
 		close(recorder)
 	}()
@@ -20,6 +20,7 @@ import (
 	"errors"
 	"reflect"
 	"testing"
+	"time"
 )
 
 type Request struct{}
@@ -112,3 +113,49 @@ func TestLoadTestConcurrencyOneError(t *testing.T) {
 	LoadTestConcurrency(workers(1), requests(Request{}), errorExec, cr)
 	assertMessages(t, cr, &StartEvent{}, &StartRequestEvent{}, &EndRequestEvent{Err: errors.New("foo")}, &EndEvent{})
 }
+
+func TestLoadTestVirtualUsersNoRequests(t *testing.T) {
+	cr := make(chan interface{})
+	LoadTestVirtualUsers(1, nil, nil, requests(), noOpExec, cr)
+	assertMessages(t, cr, &StartEvent{}, &UserEndEvent{}, &EndEvent{})
+}
+
+func TestLoadTestVirtualUsersOneError(t *testing.T) {
+	cr := make(chan interface{})
+	LoadTestVirtualUsers(1, nil, nil, requests(Request{}), errorExec, cr)
+	assertMessages(t, cr, &StartEvent{}, &StartRequestEvent{}, &EndRequestEvent{Err: errors.New("foo")}, &UserEndEvent{}, &EndEvent{})
+}
+
+func TestLoadTestVirtualUsersIterations(t *testing.T) {
+	cr := make(chan interface{})
+	LoadTestVirtualUsers(2, UniformIntervalGenerator(1e9), UniformIntervalGenerator(1e6), requests(Request{}, Request{}, Request{}, Request{}), noOpExec, cr)
+
+	total := 0
+	for msg := range cr {
+		if e, ok := msg.(*UserEndEvent); ok {
+			total += e.Iterations
+		}
+	}
+	if total != 4 {
+		t.Errorf("Expected users to complete 4 iterations, got %d", total)
+	}
+}
+
+func TestLoadTestVirtualUsersThinkTime(t *testing.T) {
+	cr := make(chan interface{})
+	think := func(int64) int64 { return int64(20 * time.Millisecond) }
+	LoadTestVirtualUsers(2, think, nil, requests(Request{}, Request{}, Request{}, Request{}, Request{}, Request{}), noOpExec, cr)
+
+	total := 0
+	for msg := range cr {
+		if e, ok := msg.(*UserEndEvent); ok {
+			total += e.Iterations
+			if elapsed := time.Duration(e.End - e.Start); elapsed < time.Duration(e.Iterations)*20*time.Millisecond {
+				t.Errorf("Expected user %d to take at least 20ms per iteration, took %v for %d", e.User, elapsed, e.Iterations)
+			}
+		}
+	}
+	if total != 6 {
+		t.Errorf("Expected users to complete 6 iterations, got %d", total)
+	}
+}
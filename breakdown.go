@@ -0,0 +1,139 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bender
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pinterest/bender/hist"
+)
+
+// BreakdownGroup holds the statistics of the requests with one set of tag values.
+type BreakdownGroup struct {
+	// The values of the breakdown's tag keys, in the same order as the keys. Requests without a tag
+	// have the empty value for it.
+	Values []string
+	// The latencies of the requests.
+	Hist *hist.Histogram
+}
+
+// Breakdown holds the statistics of a load test broken down by the values of a set of tags, like the
+// target host and the DNS query type, with a histogram for each combination of values.
+type Breakdown struct {
+	// The tag keys the requests are grouped by.
+	Keys []string
+	// The groups, by their joined values.
+	Groups map[string]*BreakdownGroup
+
+	newHist func() *hist.Histogram
+	start   int64
+}
+
+// NewBreakdown creates an empty Breakdown by the given tag keys, which uses newHist to create the
+// histogram for each group.
+func NewBreakdown(newHist func() *hist.Histogram, keys ...string) *Breakdown {
+	return &Breakdown{Keys: keys, Groups: make(map[string]*BreakdownGroup), newHist: newHist}
+}
+
+// group returns the group for the tags, creating it as needed.
+func (b *Breakdown) group(tags map[string]string) *BreakdownGroup {
+	values := make([]string, len(b.Keys))
+	for i, k := range b.Keys {
+		values[i] = tags[k]
+	}
+	key := strings.Join(values, "\x00")
+	g, ok := b.Groups[key]
+	if !ok {
+		g = &BreakdownGroup{Values: values, Hist: b.newHist()}
+		g.Hist.Start(int(b.start))
+		b.Groups[key] = g
+	}
+	return g
+}
+
+// Sorted returns the groups sorted by their values.
+func (b *Breakdown) Sorted() []*BreakdownGroup {
+	groups := make([]*BreakdownGroup, 0, len(b.Groups))
+	for _, g := range b.Groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		for k := range groups[i].Values {
+			if groups[i].Values[k] != groups[j].Values[k] {
+				return groups[i].Values[k] < groups[j].Values[k]
+			}
+		}
+		return false
+	})
+	return groups
+}
+
+// WriteTable writes a table of the breakdown to w, with a row for each group and columns for its tag
+// values, the number of requests, the error percentage, the throughput, and the mean and given
+// percentiles of the latency in milliseconds.
+func (b *Breakdown) WriteTable(w io.Writer, percentiles ...float64) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	header := append([]string(nil), b.Keys...)
+	header = append(header, "requests", "error%", "qps", "mean")
+	for _, p := range percentiles {
+		header = append(header, hist.PercentileName(p))
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, g := range b.Sorted() {
+		s := g.Hist.Summary(percentiles...)
+		ms := float64(s.Scale) / float64(time.Millisecond)
+		row := make([]string, 0, len(header))
+		for _, v := range g.Values {
+			if v == "" {
+				v = "-"
+			}
+			row = append(row, v)
+		}
+		row = append(row, fmt.Sprint(s.Count), fmt.Sprintf("%.2f", s.ErrorPercent), fmt.Sprintf("%.2f", s.QPS),
+			fmt.Sprintf("%.3f", s.Mean*ms))
+		for _, p := range s.Percentiles {
+			row = append(row, fmt.Sprintf("%.3f", p.Value*ms))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// NewBreakdownRecorder creates a new recorder that adds the latency of each request to the histogram
+// of its group in the breakdown, by the Tags of its EndRequestEvent. Requests aggregated in
+// HistogramEvents have no tags, so only the EndRequestEvents that are sent are broken down.
+func NewBreakdownRecorder(b *Breakdown) Recorder {
+	return func(msg interface{}) {
+		switch msg := msg.(type) {
+		case *StartEvent:
+			b.start = msg.Start
+			b.Groups = make(map[string]*BreakdownGroup)
+		case *EndEvent:
+			for _, g := range b.Groups {
+				g.Hist.End(int(msg.End))
+			}
+		case *EndRequestEvent:
+			addRequest(b.group(msg.Tags).Hist, msg)
+		}
+	}
+}
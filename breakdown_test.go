@@ -0,0 +1,95 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bender
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTagExecutor(t *testing.T) {
+	exec := TagExecutor(func(int64, interface{}) (interface{}, error) {
+		return TagResponse("ok", map[string]string{TagTarget: "a:53"}), nil
+	}, map[string]string{"scenario": "login"})
+
+	res, err := exec(0, Request{})
+	inner, tags := untagResponse(res)
+	if err != nil || inner != "ok" || tags[TagTarget] != "a:53" || tags["scenario"] != "login" {
+		t.Errorf("Expected tagged response, got (%v, %v, %v)", inner, tags, err)
+	}
+	if UnwrapResponse(res) != "ok" || UnwrapResponse("raw") != "raw" {
+		t.Errorf("Expected UnwrapResponse to return the inner response")
+	}
+}
+
+func TestLoadTestTags(t *testing.T) {
+	cr := make(chan interface{})
+	exec := TagExecutor(errorExec, map[string]string{TagTarget: "a:53"})
+	LoadTestConcurrency(workers(1), requests(Request{}), exec, cr)
+
+	<-cr
+	<-cr
+	msg := (<-cr).(*EndRequestEvent)
+	if msg.Response != nil || msg.Err == nil || msg.Tags[TagTarget] != "a:53" {
+		t.Errorf("Expected unwrapped response with tags, got %+v", msg)
+	}
+	<-cr
+}
+
+func TestBreakdownRecorder(t *testing.T) {
+	hosts := []string{"a:53", "b:53", "a:53", "a:53"}
+	i := 0
+	exec := func(_ int64, request interface{}) (interface{}, error) {
+		host := hosts[i]
+		i++
+		res := TagResponse(nil, map[string]string{TagTarget: host})
+		if host == "b:53" {
+			_, err := errorExec(0, request)
+			return res, err
+		}
+		return res, nil
+	}
+	cr := make(chan interface{})
+	LoadTestConcurrency(workers(1), requests(Request{}, Request{}, Request{}, Request{}), exec, cr)
+
+	b := NewBreakdown(newTestHist, TagTarget, TagQType)
+	Record(cr, NewBreakdownRecorder(b))
+
+	groups := b.Sorted()
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %d", len(groups))
+	}
+	if v := groups[0].Values; v[0] != "a:53" || v[1] != "" || groups[0].Hist.Count() != 3 || groups[0].Hist.Errors() != 0 {
+		t.Errorf("Unexpected group %v with %d requests", v, groups[0].Hist.Count())
+	}
+	if v := groups[1].Values; v[0] != "b:53" || groups[1].Hist.Count() != 1 || groups[1].Hist.Errors() != 1 {
+		t.Errorf("Unexpected group %v with %d requests", v, groups[1].Hist.Count())
+	}
+
+	var buf bytes.Buffer
+	if err := b.WriteTable(&buf, 0.5, 0.99); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || strings.Join(strings.Fields(lines[0]), " ") != "target qtype requests error% qps mean p50 p99" {
+		t.Fatalf("Unexpected table:\n%s", buf.String())
+	}
+	if f := strings.Fields(lines[2]); f[0] != "b:53" || f[1] != "-" || f[2] != "1" || f[3] != "100.00" {
+		t.Errorf("Unexpected row %q", lines[2])
+	}
+}
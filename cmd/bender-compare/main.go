@@ -0,0 +1,98 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command bender-compare compares the saved results of two load test runs, and exits with status 1 if
+// the candidate run regressed, so it can gate a CI pipeline:
+//
+//	bender-compare [flags] base.json candidate.json
+//
+// The results can be histograms, in JSON or binary, or windowed stats in JSON.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pinterest/bender/compare"
+)
+
+func main() {
+	percentiles := flag.String("percentiles", "0.5,0.9,0.99", "comma separated percentiles to compare")
+	maxIncrease := flag.Float64("max-increase", 0.1, "largest allowed relative increase of each percentile; "+
+		"if not set, the percentiles of compare.DefaultThresholds use theirs, like 0.2 for p99")
+	maxErrorIncrease := flag.Float64("max-error-increase", compare.DefaultThresholds.MaxErrorIncrease,
+		"largest allowed increase of the error percentage, in percentage points")
+	alpha := flag.Float64("alpha", compare.DefaultThresholds.Alpha,
+		"significance level of the Mann-Whitney test for median latency regressions, or 0 to disable the test")
+	jsonOut := flag.Bool("json", false, "write the comparison as JSON")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] base candidate\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	maxIncreaseSet := false
+	flag.Visit(func(f *flag.Flag) {
+		maxIncreaseSet = maxIncreaseSet || f.Name == "max-increase"
+	})
+	th := compare.Thresholds{
+		Percentiles:      make(map[float64]float64),
+		MaxErrorIncrease: *maxErrorIncrease,
+		Alpha:            *alpha,
+	}
+	for _, s := range strings.Split(*percentiles, ",") {
+		p, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil || p < 0 || p > 1 {
+			fmt.Fprintf(os.Stderr, "invalid percentile %q\n", s)
+			os.Exit(2)
+		}
+		th.Percentiles[p] = *maxIncrease
+		if def, ok := compare.DefaultThresholds.Percentiles[p]; ok && !maxIncreaseSet {
+			th.Percentiles[p] = def
+		}
+	}
+
+	base, err := compare.LoadFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	candidate, err := compare.LoadFile(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	result := compare.Compare(base, candidate, th)
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(result)
+	} else {
+		fmt.Print(result)
+	}
+	if result.Regressed() {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package compare compares the results of two runs of a load test, like before and after a deploy,
+// and flags latency and error rate regressions. Latencies are compared by their percentiles, and by
+// Mann-Whitney U and Kolmogorov-Smirnov tests on the whole distributions, so that noise in the median
+// between runs isn't reported as a regression.
+package compare
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pinterest/bender"
+	"github.com/pinterest/bender/hist"
+)
+
+// Load reads the results of a load test saved as a histogram, in the JSON or binary encoding, or as
+// windowed stats in JSON, whose windows are merged into one histogram.
+func Load(r io.Reader) (*hist.Histogram, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	h := &hist.Histogram{}
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		if err := h.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		return h, nil
+	}
+
+	var probe struct {
+		Windows json.RawMessage `json:"windows"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+	if probe.Windows == nil {
+		if err := json.Unmarshal(data, h); err != nil {
+			return nil, err
+		}
+		return h, nil
+	}
+	var ws bender.WindowedStats
+	if err := json.Unmarshal(data, &ws); err != nil {
+		return nil, err
+	}
+	return ws.Total()
+}
+
+// LoadFile reads the results of a load test from a file, like Load.
+func LoadFile(path string) (*hist.Histogram, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h, err := Load(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return h, nil
+}
+
+// Thresholds are the limits beyond which a change between two runs is a regression.
+type Thresholds struct {
+	// Percentiles maps each compared percentile to the largest allowed relative increase of its
+	// latency, like 0.1 for 10%.
+	Percentiles map[float64]float64
+	// MaxErrorIncrease is the largest allowed increase of the error percentage, in percentage points.
+	MaxErrorIncrease float64
+	// If Alpha is not zero, increases of the median and lower percentiles are only regressions if
+	// the Mann-Whitney U test finds that the candidate's latencies are larger with a p-value below
+	// Alpha, so that noise between runs is ignored. The test is insensitive to changes of the tail of
+	// the distribution, like 1% of the requests becoming 10 times slower, so it doesn't apply to the
+	// percentiles above the median.
+	Alpha float64
+}
+
+// DefaultThresholds flag a 10% increase of the median or p90 latency, a 20% increase of the p99
+// latency or a 0.5 point increase of the error percentage, if the increase of the median is
+// significant at the 1% level.
+var DefaultThresholds = Thresholds{
+	Percentiles:      map[float64]float64{0.5: 0.1, 0.9: 0.1, 0.99: 0.2},
+	MaxErrorIncrease: 0.5,
+	Alpha:            0.01,
+}
+
+// PercentileDelta is the change of the latency of one percentile between two runs.
+type PercentileDelta struct {
+	P         float64       `json:"p"`
+	Base      time.Duration `json:"base"`
+	Candidate time.Duration `json:"candidate"`
+	// The relative change, like 0.1 for a 10% increase.
+	Change     float64 `json:"change"`
+	Regression bool    `json:"regression"`
+}
+
+// Result is the comparison of a candidate run with a base run.
+type Result struct {
+	Percentiles           []PercentileDelta `json:"percentiles"`
+	BaseErrorPercent      float64           `json:"base_error_percent"`
+	CandidateErrorPercent float64           `json:"candidate_error_percent"`
+	// The statistical tests of the successful request latencies.
+	MannWhitney MannWhitneyTest `json:"mann_whitney"`
+	KS          KSTest          `json:"ks"`
+	// A description of each regression.
+	Regressions []string `json:"regressions"`
+}
+
+// Regressed returns true if the candidate run regressed beyond the thresholds.
+func (r *Result) Regressed() bool {
+	return len(r.Regressions) > 0
+}
+
+// Compare compares the latencies and error rates of a candidate run with those of a base run. The
+// latencies of successful requests only are compared, since fast errors would otherwise hide a
+// latency regression. The histograms don't need to have the same bucketing.
+func Compare(base, candidate *hist.Histogram, th Thresholds) *Result {
+	r := &Result{
+		BaseErrorPercent:      errorPercent(base),
+		CandidateErrorPercent: errorPercent(candidate),
+	}
+	bs, cs := base.Successes(), candidate.Successes()
+	paired := pair(bins(bs), bins(cs))
+	r.MannWhitney = mannWhitneyTest(paired)
+	r.KS = ksTest(paired)
+	significant := th.Alpha == 0 || r.MannWhitney.PValue < th.Alpha
+
+	percentiles := make([]float64, 0, len(th.Percentiles))
+	for p := range th.Percentiles {
+		percentiles = append(percentiles, p)
+	}
+	sort.Float64s(percentiles)
+	bv, cv := bs.InterpolatedPercentiles(percentiles...), cs.InterpolatedPercentiles(percentiles...)
+	for i, p := range percentiles {
+		d := PercentileDelta{
+			P:         p,
+			Base:      time.Duration(bv[i] * float64(bs.Scale())),
+			Candidate: time.Duration(cv[i] * float64(cs.Scale())),
+		}
+		if d.Base > 0 {
+			d.Change = float64(d.Candidate-d.Base) / float64(d.Base)
+		}
+		if d.Change > th.Percentiles[p] && (significant || p > 0.5) && bs.Count() > 0 && cs.Count() > 0 {
+			d.Regression = true
+			r.Regressions = append(r.Regressions, fmt.Sprintf("%s latency increased by %.1f%% (max %.1f%%)",
+				hist.PercentileName(p), d.Change*100, th.Percentiles[p]*100))
+		}
+		r.Percentiles = append(r.Percentiles, d)
+	}
+
+	if inc := r.CandidateErrorPercent - r.BaseErrorPercent; inc > th.MaxErrorIncrease {
+		r.Regressions = append(r.Regressions, fmt.Sprintf("error percentage increased by %.2f points (max %.2f)",
+			inc, th.MaxErrorIncrease))
+	}
+	return r
+}
+
+func errorPercent(h *hist.Histogram) float64 {
+	if h.Count() == 0 {
+		return 0
+	}
+	return h.ErrorPercent()
+}
+
+func (r *Result) String() string {
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "\tbase\tcandidate\tchange\t\t")
+	for _, d := range r.Percentiles {
+		flag := ""
+		if d.Regression {
+			flag = "REGRESSION"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%+.1f%%\t%s\t\n", hist.PercentileName(d.P),
+			d.Base.Round(time.Microsecond), d.Candidate.Round(time.Microsecond), d.Change*100, flag)
+	}
+	fmt.Fprintf(tw, "error%%\t%.2f\t%.2f\t%+.2f\t\t\n", r.BaseErrorPercent, r.CandidateErrorPercent,
+		r.CandidateErrorPercent-r.BaseErrorPercent)
+	tw.Flush()
+
+	fmt.Fprintf(&b, "Mann-Whitney U: z=%.2f p=%.4g P(candidate slower)=%.3f\n",
+		r.MannWhitney.Z, r.MannWhitney.PValue, r.MannWhitney.Effect)
+	fmt.Fprintf(&b, "Kolmogorov-Smirnov: D=%.4f p=%.4g\n", r.KS.D, r.KS.PValue)
+	if r.Regressed() {
+		for _, reg := range r.Regressions {
+			fmt.Fprintf(&b, "Regression: %s\n", reg)
+		}
+	} else {
+		b.WriteString("No regressions\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package compare
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pinterest/bender"
+	"github.com/pinterest/bender/hist"
+)
+
+// testHistogram returns a histogram of n latencies spread uniformly around the given mean, with the
+// given number of errors.
+func testHistogram(seed int64, n int, mean time.Duration, errs int) *hist.Histogram {
+	r := rand.New(rand.NewSource(seed))
+	h := hist.NewLogHistogram(3, int(time.Microsecond))
+	for i := 0; i < n; i++ {
+		v := int(float64(mean) * (0.5 + r.Float64()))
+		if i < errs {
+			h.AddErrorClass(v, "timeout", "timeout")
+		} else {
+			h.Add(v)
+		}
+	}
+	return h
+}
+
+func TestMannWhitney(t *testing.T) {
+	a := []bin{{1, 1}, {2, 1}, {3, 1}}
+	b := []bin{{4, 1}, {5, 1}, {6, 1}}
+	mw := mannWhitneyTest(pair(a, b))
+	if mw.U != 9 || mw.Effect != 1 || math.Abs(mw.Z-1.964) > 0.001 || math.Abs(mw.PValue-0.0248) > 0.0001 {
+		t.Errorf("Unexpected test result %+v", mw)
+	}
+	// With all values tied, neither distribution is larger.
+	mw = mannWhitneyTest(pair([]bin{{1, 5}}, []bin{{1, 5}}))
+	if mw.Effect != 0.5 || mw.PValue != 0.5 {
+		t.Errorf("Unexpected test result for ties %+v", mw)
+	}
+}
+
+func TestKS(t *testing.T) {
+	ks := ksTest(pair([]bin{{1, 100}}, []bin{{2, 100}}))
+	if ks.D != 1 || ks.PValue > 1e-6 {
+		t.Errorf("Unexpected test result %+v", ks)
+	}
+	ks = ksTest(pair([]bin{{1, 50}, {2, 50}}, []bin{{1, 50}, {2, 50}}))
+	if ks.D != 0 || ks.PValue != 1 {
+		t.Errorf("Unexpected test result %+v", ks)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	base := testHistogram(1, 5000, 10*time.Millisecond, 0)
+
+	r := Compare(base, testHistogram(2, 5000, 10*time.Millisecond, 0), DefaultThresholds)
+	if r.Regressed() {
+		t.Errorf("Expected no regression for the same distribution, got\n%s", r)
+	}
+
+	r = Compare(base, testHistogram(3, 5000, 13*time.Millisecond, 0), DefaultThresholds)
+	if !r.Regressed() || len(r.Regressions) != 3 || !r.Percentiles[0].Regression {
+		t.Errorf("Expected latency regressions, got\n%s", r)
+	}
+	if c := r.Percentiles[0].Change; math.Abs(c-0.3) > 0.03 {
+		t.Errorf("Expected a 30%% increase of the median, got %f", c)
+	}
+	if !strings.Contains(r.String(), "Regression: p50 latency increased") {
+		t.Errorf("Unexpected output\n%s", r)
+	}
+
+	r = Compare(base, testHistogram(2, 5000, 10*time.Millisecond, 100), DefaultThresholds)
+	if len(r.Regressions) != 1 || !strings.HasPrefix(r.Regressions[0], "error percentage increased by 2.00 points") {
+		t.Errorf("Expected an error regression, got\n%s", r)
+	}
+}
+
+func TestCompareSmallNoisySample(t *testing.T) {
+	// A different median in a small sample isn't significant.
+	base := testHistogram(1, 20, 10*time.Millisecond, 0)
+	candidate := testHistogram(4, 20, 11*time.Millisecond, 0)
+	th := Thresholds{Percentiles: map[float64]float64{0.5: 0.05}, Alpha: 0.01}
+	if r := Compare(base, candidate, th); r.Regressed() {
+		t.Errorf("Expected no significant regression, got\n%s", r)
+	}
+	th.Alpha = 0
+	if r := Compare(base, candidate, th); !r.Regressed() {
+		t.Errorf("Expected a regression without the significance test, got\n%s", r)
+	}
+}
+
+func TestCompareTailRegression(t *testing.T) {
+	// 1.5% of the requests becoming 10 times slower doesn't move the median, but is a regression of
+	// the p99 latency, even though the Mann-Whitney test isn't significant.
+	base := testHistogram(1, 1000, 10*time.Millisecond, 0)
+	candidate := testHistogram(2, 985, 10*time.Millisecond, 0)
+	for i := 0; i < 15; i++ {
+		candidate.Add(int(100 * time.Millisecond))
+	}
+	r := Compare(base, candidate, DefaultThresholds)
+	if r.MannWhitney.PValue < DefaultThresholds.Alpha {
+		t.Fatalf("Expected the Mann-Whitney test not to be significant, got %+v", r.MannWhitney)
+	}
+	if len(r.Regressions) != 1 || !strings.HasPrefix(r.Regressions[0], "p99 latency increased") {
+		t.Errorf("Expected a p99 regression only, got\n%s", r)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	h := testHistogram(1, 100, time.Millisecond, 0)
+	jsonData, _ := json.Marshal(h)
+	binaryData, _ := h.MarshalBinary()
+
+	ws := bender.NewWindowedStats(time.Second, func() *hist.Histogram { return hist.NewLogHistogram(3, int(time.Microsecond)) })
+	rec := bender.NewWindowedRecorder(ws)
+	rec(&bender.StartEvent{Start: 0})
+	for i := int64(0); i < 100; i++ {
+		rec(&bender.EndRequestEvent{Start: i * int64(time.Millisecond), End: i*int64(time.Millisecond) + int64(time.Millisecond) + 1})
+	}
+	rec(&bender.EndRequestEvent{Start: 0, End: 1, Err: errors.New("error")})
+	rec(&bender.EndEvent{Start: 0, End: int64(2 * time.Second)})
+	wsData, _ := json.Marshal(ws)
+
+	for _, tc := range []struct {
+		name        string
+		data        []byte
+		n, errCount int
+	}{
+		{"json", jsonData, 100, 0},
+		{"binary", binaryData, 100, 0},
+		{"windowed", wsData, 101, 1},
+	} {
+		l, err := Load(bytes.NewReader(tc.data))
+		if err != nil {
+			t.Errorf("%s: Expected no error, got (%v)", tc.name, err)
+			continue
+		}
+		if l.Count() != tc.n || l.Errors() != tc.errCount {
+			t.Errorf("%s: Expected %d values and %d errors, got %d and %d", tc.name, tc.n, tc.errCount, l.Count(), l.Errors())
+		}
+	}
+	if _, err := Load(strings.NewReader("not a histogram")); err == nil {
+		t.Errorf("Expected an error for invalid data")
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package compare
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pinterest/bender/hist"
+)
+
+// bin is a histogram bucket with its value in nanoseconds.
+type bin struct {
+	value time.Duration
+	count int
+}
+
+func bins(h *hist.Histogram) []bin {
+	scale := h.Scale()
+	var result []bin
+	for _, b := range h.Buckets() {
+		result = append(result, bin{time.Duration(b.Value) * scale, b.Count})
+	}
+	return result
+}
+
+// pairedBin holds the counts of the two distributions at one value.
+type pairedBin struct {
+	a, b int
+}
+
+// pair merges the bins of two distributions, which may have different bucketing, into one list of
+// bins in increasing order of value.
+func pair(a, b []bin) []pairedBin {
+	counts := make(map[time.Duration]*pairedBin)
+	for _, x := range a {
+		if counts[x.value] == nil {
+			counts[x.value] = &pairedBin{}
+		}
+		counts[x.value].a += x.count
+	}
+	for _, x := range b {
+		if counts[x.value] == nil {
+			counts[x.value] = &pairedBin{}
+		}
+		counts[x.value].b += x.count
+	}
+	values := make([]time.Duration, 0, len(counts))
+	for v := range counts {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	result := make([]pairedBin, len(values))
+	for i, v := range values {
+		result[i] = *counts[v]
+	}
+	return result
+}
+
+// KSTest is the result of a two-sample Kolmogorov-Smirnov test.
+type KSTest struct {
+	// The largest difference between the two cumulative distributions.
+	D float64 `json:"d"`
+	// The probability of a difference at least this large if both samples came from the same
+	// distribution.
+	PValue float64 `json:"p_value"`
+}
+
+// ksTest runs a two-sample Kolmogorov-Smirnov test on binned data, using the asymptotic distribution
+// of the statistic. Binning makes the test conservative, since differences within a bin are lost.
+func ksTest(bins []pairedBin) KSTest {
+	na, nb := 0, 0
+	for _, b := range bins {
+		na, nb = na+b.a, nb+b.b
+	}
+	if na == 0 || nb == 0 {
+		return KSTest{PValue: 1}
+	}
+	d, ca, cb := 0.0, 0, 0
+	for _, b := range bins {
+		ca, cb = ca+b.a, cb+b.b
+		d = math.Max(d, math.Abs(float64(ca)/float64(na)-float64(cb)/float64(nb)))
+	}
+	en := math.Sqrt(float64(na) * float64(nb) / float64(na+nb))
+	return KSTest{D: d, PValue: kolmogorovQ((en + 0.12 + 0.11/en) * d)}
+}
+
+// kolmogorovQ returns the complementary cumulative Kolmogorov distribution function.
+func kolmogorovQ(lambda float64) float64 {
+	if lambda < 0.2 {
+		return 1
+	}
+	sum, sign := 0.0, 1.0
+	for j := 1; j <= 100; j++ {
+		term := sign * math.Exp(-2*float64(j*j)*lambda*lambda)
+		sum += term
+		if math.Abs(term) < 1e-12 {
+			break
+		}
+		sign = -sign
+	}
+	return math.Max(0, math.Min(1, 2*sum))
+}
+
+// MannWhitneyTest is the result of a one-sided Mann-Whitney U test of whether the candidate's values
+// tend to be larger than the base's.
+type MannWhitneyTest struct {
+	// The U statistic of the candidate.
+	U float64 `json:"u"`
+	// The normal approximation of U, corrected for ties.
+	Z float64 `json:"z"`
+	// The probability of a U at least this large if neither distribution tends to be larger.
+	PValue float64 `json:"p_value"`
+	// The probability that a random candidate value is larger than a random base value, counting
+	// ties as half.
+	Effect float64 `json:"effect"`
+}
+
+// mannWhitneyTest runs a one-sided Mann-Whitney U test on binned data, where the values in each bin
+// are ties.
+func mannWhitneyTest(bins []pairedBin) MannWhitneyTest {
+	na, nb := 0, 0
+	for _, b := range bins {
+		na, nb = na+b.a, nb+b.b
+	}
+	if na == 0 || nb == 0 {
+		return MannWhitneyTest{PValue: 1, Effect: 0.5}
+	}
+
+	// Sum the (mid)ranks of the candidate's values, and the tie correction term.
+	rank, rb, ties := 0.0, 0.0, 0.0
+	for _, b := range bins {
+		t := float64(b.a + b.b)
+		rb += float64(b.b) * (rank + (t+1)/2)
+		ties += t*t*t - t
+		rank += t
+	}
+	fa, fb, n := float64(na), float64(nb), float64(na+nb)
+	u := rb - fb*(fb+1)/2
+	mean := fa * fb / 2
+	variance := fa * fb / 12 * ((n + 1) - ties/(n*(n-1)))
+	result := MannWhitneyTest{U: u, Effect: u / (fa * fb), PValue: 0.5}
+	if variance > 0 {
+		result.Z = (u - mean) / math.Sqrt(variance)
+		result.PValue = 0.5 * math.Erfc(result.Z/math.Sqrt2)
+	}
+	return result
+}
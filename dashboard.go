@@ -0,0 +1,313 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bender
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pinterest/bender/hist"
+)
+
+// sparkWidth is the number of intervals shown in the dashboard's latency sparkline.
+const sparkWidth = 60
+
+var sparkRunes = []rune("▁▂▃▄▅▆▇█")
+
+// dashboardPercentiles are the rolling latency percentiles shown by the dashboard.
+var dashboardPercentiles = []float64{0.5, 0.9, 0.99}
+
+// dashboard holds the state of a dashboard recorder. The counters are updated by the recorder and
+// read by the goroutine that draws the dashboard, so they are protected by the mutex.
+type dashboard struct {
+	w         io.Writer
+	tty       bool
+	interval  time.Duration
+	targetQPS float64
+
+	mu       sync.Mutex
+	start    time.Time
+	inFlight int
+	requests int
+	errors   int
+	classes  map[ErrorClass]int
+	overage  time.Duration
+	// The latencies of the requests that ended since the last draw, and the number of them.
+	recent     *hist.Histogram
+	recentReqs int
+	// The p90 latency (in microseconds) of each interval, for the sparkline.
+	spark []float64
+	// The number of lines drawn last time, which are overwritten by the next draw on a terminal.
+	lines int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// isTerminal returns true if w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// NewDashboardRecorder creates a new recorder that shows the progress of a load test on w every
+// interval. If w is a terminal, it redraws a compact status panel with the elapsed time, target and
+// actual QPS, in-flight requests, error rate by class, p50/p90/p99 latency over the last interval,
+// overage and a sparkline of the p90 latency; otherwise it writes the same statistics as one line of
+// plain text per interval. The targetQPS is shown next to the actual QPS, unless it is zero. It
+// panics if the interval isn't positive.
+//
+// The dashboard is drawn by a goroutine which is started by the StartEvent and stopped by the
+// EndEvent, after drawing the dashboard one last time.
+func NewDashboardRecorder(w io.Writer, interval time.Duration, targetQPS float64) Recorder {
+	if interval <= 0 {
+		panic(fmt.Sprintf("bender: invalid dashboard interval %v", interval))
+	}
+	d := &dashboard{w: w, tty: isTerminal(w), interval: interval, targetQPS: targetQPS}
+	return d.record
+}
+
+func (d *dashboard) record(msg interface{}) {
+	switch msg := msg.(type) {
+	case *StartEvent:
+		d.mu.Lock()
+		d.start = time.Unix(0, msg.Start)
+		d.classes = make(map[ErrorClass]int)
+		d.recent = hist.NewLogHistogram(2, int(time.Microsecond))
+		d.mu.Unlock()
+		d.stop, d.done = make(chan struct{}), make(chan struct{})
+		go d.run()
+	case *EndEvent:
+		if d.stop != nil {
+			close(d.stop)
+			<-d.done
+			d.stop = nil
+		}
+	case *WaitEvent:
+		d.mu.Lock()
+		d.overage = time.Duration(msg.Overage)
+		d.mu.Unlock()
+	case *StartRequestEvent:
+		d.mu.Lock()
+		d.inFlight++
+		d.mu.Unlock()
+	case *EndRequestEvent:
+		d.mu.Lock()
+		d.inFlight--
+		d.requests++
+		if msg.Err != nil {
+			d.errors++
+			d.classes[msg.ErrorClass()]++
+		}
+		if d.recent != nil {
+			d.recent.Add(int(msg.End - msg.Start))
+			d.recentReqs++
+		}
+		d.mu.Unlock()
+	}
+}
+
+func (d *dashboard) run() {
+	defer close(d.done)
+	t := time.NewTicker(d.interval)
+	defer t.Stop()
+	last := time.Now()
+	for {
+		select {
+		case now := <-t.C:
+			d.draw(now, now.Sub(last))
+			last = now
+		case <-d.stop:
+			now := time.Now()
+			d.draw(now, now.Sub(last))
+			return
+		}
+	}
+}
+
+// dashboardStats is a snapshot of the dashboard's statistics for one interval.
+type dashboardStats struct {
+	elapsed     time.Duration
+	qps         float64
+	targetQPS   float64
+	inFlight    int
+	requests    int
+	errors      int
+	classes     map[ErrorClass]int
+	percentiles []float64
+	overage     time.Duration
+	spark       []float64
+}
+
+// snapshot returns the statistics for the interval of the given length ending now, and starts the
+// next interval.
+func (d *dashboard) snapshot(now time.Time, length time.Duration) *dashboardStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s := &dashboardStats{
+		elapsed:   now.Sub(d.start),
+		targetQPS: d.targetQPS,
+		inFlight:  d.inFlight,
+		requests:  d.requests,
+		errors:    d.errors,
+		classes:   make(map[ErrorClass]int, len(d.classes)),
+		overage:   d.overage,
+	}
+	if length > 0 {
+		s.qps = float64(d.recentReqs) / length.Seconds()
+	}
+	for c, n := range d.classes {
+		s.classes[c] = n
+	}
+	if d.recentReqs > 0 {
+		s.percentiles = d.recent.InterpolatedPercentiles(dashboardPercentiles...)
+		d.spark = append(d.spark, s.percentiles[1])
+	} else {
+		d.spark = append(d.spark, 0)
+	}
+	if len(d.spark) > sparkWidth {
+		d.spark = d.spark[len(d.spark)-sparkWidth:]
+	}
+	s.spark = append([]float64(nil), d.spark...)
+
+	d.recent = hist.NewLogHistogram(2, int(time.Microsecond))
+	d.recentReqs = 0
+	return s
+}
+
+func (d *dashboard) draw(now time.Time, length time.Duration) {
+	s := d.snapshot(now, length)
+	if !d.tty {
+		fmt.Fprintln(d.w, s.line())
+		return
+	}
+
+	var b strings.Builder
+	if d.lines > 0 {
+		// Move the cursor back to the start of the previous panel.
+		fmt.Fprintf(&b, "\x1b[%dA", d.lines)
+	}
+	panel := s.panel()
+	for _, line := range panel {
+		b.WriteString("\x1b[2K")
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	d.lines = len(panel)
+	io.WriteString(d.w, b.String())
+}
+
+// formatLatency formats a latency in microseconds as milliseconds.
+func formatLatency(us float64) string {
+	return fmt.Sprintf("%.2fms", us/1000)
+}
+
+func (s *dashboardStats) qpsString() string {
+	if s.targetQPS == 0 {
+		return fmt.Sprintf("%.1f", s.qps)
+	}
+	return fmt.Sprintf("%.1f/%.1f", s.qps, s.targetQPS)
+}
+
+func (s *dashboardStats) errorPercent(n int) float64 {
+	if s.requests == 0 {
+		return 0
+	}
+	return float64(n) / float64(s.requests) * 100
+}
+
+// classString returns the error rate of each class, from the most to the least common.
+func (s *dashboardStats) classString() string {
+	classes := make([]ErrorClass, 0, len(s.classes))
+	for c := range s.classes {
+		classes = append(classes, c)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		if s.classes[classes[i]] != s.classes[classes[j]] {
+			return s.classes[classes[i]] > s.classes[classes[j]]
+		}
+		return classes[i] < classes[j]
+	})
+	parts := make([]string, len(classes))
+	for i, c := range classes {
+		parts[i] = fmt.Sprintf("%s %.2f%%", c, s.errorPercent(s.classes[c]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (s *dashboardStats) percentileString() string {
+	if s.percentiles == nil {
+		return "p50 -  p90 -  p99 -"
+	}
+	return fmt.Sprintf("p50 %s  p90 %s  p99 %s", formatLatency(s.percentiles[0]),
+		formatLatency(s.percentiles[1]), formatLatency(s.percentiles[2]))
+}
+
+// line returns the statistics as a single line of plain text.
+func (s *dashboardStats) line() string {
+	line := fmt.Sprintf("elapsed=%s qps=%s in_flight=%d requests=%d errors=%.2f%%",
+		s.elapsed.Round(time.Second), s.qpsString(), s.inFlight, s.requests, s.errorPercent(s.errors))
+	if len(s.classes) > 0 {
+		line += " (" + s.classString() + ")"
+	}
+	return line + " " + strings.Replace(s.percentileString(), "  ", " ", -1) + " overage=" + s.overage.String()
+}
+
+// panel returns the lines of the status panel.
+func (s *dashboardStats) panel() []string {
+	errors := fmt.Sprintf("%.2f%%", s.errorPercent(s.errors))
+	if len(s.classes) > 0 {
+		errors += " (" + s.classString() + ")"
+	}
+	return []string{
+		fmt.Sprintf("elapsed   %s", s.elapsed.Round(time.Second)),
+		fmt.Sprintf("qps       %s    in flight %d    requests %d", s.qpsString(), s.inFlight, s.requests),
+		fmt.Sprintf("errors    %s", errors),
+		fmt.Sprintf("latency   %s", s.percentileString()),
+		fmt.Sprintf("overage   %s", s.overage),
+		fmt.Sprintf("p90       %s", sparkline(s.spark)),
+	}
+}
+
+// sparkline draws the values as a line of block characters, scaled to the largest value.
+func sparkline(values []float64) string {
+	max := 0.0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	runes := make([]rune, len(values))
+	for i, v := range values {
+		j := 0
+		if max > 0 {
+			j = int(v / max * float64(len(sparkRunes)-1))
+		}
+		runes[i] = sparkRunes[j]
+	}
+	return string(runes)
+}
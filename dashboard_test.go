@@ -0,0 +1,88 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bender
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDashboardPlainText(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewDashboardRecorder(&buf, time.Hour, 100)
+	now := time.Now().UnixNano()
+	ms := int64(time.Millisecond)
+	r(&StartEvent{Start: now})
+	r(&WaitEvent{Wait: 0, Overage: 5 * ms, Time: now})
+	for i := int64(1); i <= 4; i++ {
+		r(&StartRequestEvent{now, nil})
+		r(&EndRequestEvent{Start: now, End: now + i*ms})
+	}
+	r(&StartRequestEvent{now, nil})
+	r(&EndRequestEvent{Start: now, End: now + ms, Err: TagError(ErrorClassTimeout, errors.New("timeout"))})
+	r(&StartRequestEvent{now, nil})
+	r(&EndEvent{now, now})
+
+	out := buf.String()
+	if strings.Count(out, "\n") != 1 {
+		t.Fatalf("Expected one line, got %q", out)
+	}
+	for _, s := range []string{"/100.0", "in_flight=1", "requests=5", "errors=20.00% (timeout 20.00%)", "p50 ", "overage=5ms"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("Expected %q in %q", s, out)
+		}
+	}
+	if strings.Contains(out, "\x1b[") {
+		t.Errorf("Unexpected escape sequence in %q", out)
+	}
+}
+
+func TestDashboardPanel(t *testing.T) {
+	d := &dashboard{tty: true, classes: map[ErrorClass]int{}}
+	var buf bytes.Buffer
+	d.w = &buf
+	d.draw(time.Now(), time.Second)
+	d.draw(time.Now(), time.Second)
+	out := buf.String()
+	if !strings.Contains(out, "\x1b[6A") {
+		t.Errorf("Expected the second panel to overwrite the first, got %q", out)
+	}
+	if strings.Count(out, "latency   p50 -") != 2 {
+		t.Errorf("Expected two panels without latencies, got %q", out)
+	}
+}
+
+func TestDashboardInterval(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic creating a dashboard with a zero interval")
+		}
+	}()
+	NewDashboardRecorder(&bytes.Buffer{}, 0, 0)
+}
+
+func TestSparkline(t *testing.T) {
+	if s := sparkline([]float64{0, 1, 2, 7}); s != "▁▂▃█" {
+		t.Errorf("Unexpected sparkline %q", s)
+	}
+	if s := sparkline([]float64{0, 0}); s != "▁▁" {
+		t.Errorf("Unexpected sparkline %q", s)
+	}
+}
@@ -2,6 +2,7 @@ package dhcpv4
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 
@@ -27,17 +28,40 @@ func CreateExecutor(client *nclient4.Client, relayIP net.IP, validator ResponseV
 		relayMod(dis)
 		off, err := client.SendAndRead(ctx, client.RemoteAddr(), dis, nclient4.IsMessageType(dhcpv4.MessageTypeOffer))
 		if err != nil {
-			return nil, fmt.Errorf("error receiving DHCP offer: %w", err)
+			return nil, tagError(fmt.Errorf("error receiving DHCP offer: %w", err))
 		}
 		req, err := dhcpv4.NewRequestFromOffer(off, relayMod)
 		if err != nil {
-			return nil, err
+			return nil, bender.TagError(bender.ErrorClassProtocol, err)
 		}
 		ack, err := client.SendAndRead(ctx, client.RemoteAddr(), req, nclient4.IsMessageType(dhcpv4.MessageTypeAck))
 		if err != nil {
-			return nil, fmt.Errorf("error receiving DHCP ACK: %w", err)
+			return nil, tagError(fmt.Errorf("error receiving DHCP ACK: %w", err))
 		}
 		err = validator(dis, ack)
-		return ack, err
+		return ack, bender.TagError(bender.ErrorClassValidation, err)
 	}, nil
 }
+
+// tagError tags an error returned by the client, which uses ErrNoResponse for timeouts.
+func tagError(err error) error {
+	if errors.Is(err, nclient4.ErrNoResponse) {
+		return bender.TagError(bender.ErrorClassTimeout, err)
+	}
+	return bender.TagNetworkError(err)
+}
+
+// LeasedIPExtractor creates an Extractor that returns the IP address (as a net.IP) leased to the
+// client by the DHCP ACK returned by the executor.
+func LeasedIPExtractor() bender.Extractor {
+	return func(res interface{}) (interface{}, error) {
+		ack, ok := res.(*dhcpv4.DHCPv4)
+		if !ok {
+			return nil, fmt.Errorf("invalid response type %T, want: *dhcpv4.DHCPv4", res)
+		}
+		if ack.YourIPAddr == nil || ack.YourIPAddr.IsUnspecified() {
+			return nil, errors.New("no leased IP in response")
+		}
+		return ack.YourIPAddr, nil
+	}
+}
@@ -22,3 +22,14 @@ func TestExecutorTypeCheck(t *testing.T) {
 		t.Errorf("Expected executor to fail with invalid request type error, got (%v)", err)
 	}
 }
+
+func TestLeasedIPExtractor(t *testing.T) {
+	ack, err := dhcpv4.New(dhcpv4.WithYourIP(net.IP{10, 0, 0, 1}))
+	if err != nil {
+		t.Fatalf("Expected no error when creating ACK, got (%v)", err)
+	}
+	v, err := LeasedIPExtractor()(ack)
+	if err != nil || !v.(net.IP).Equal(net.IP{10, 0, 0, 1}) {
+		t.Errorf("Actual(%v, %v) != Expected(%v)", v, err, "10.0.0.1")
+	}
+}
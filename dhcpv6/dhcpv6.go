@@ -32,7 +32,7 @@ func CreateExecutor(client *async.Client, validator ResponseValidator) bender.Re
 		}
 		req, err := relayRequestFromAdvertise(adv)
 		if err != nil {
-			return nil, err
+			return nil, bender.TagError(bender.ErrorClassProtocol, err)
 		}
 		res, err := send(client, req)
 		if err != nil {
@@ -40,10 +40,10 @@ func CreateExecutor(client *async.Client, validator ResponseValidator) bender.Re
 		}
 		_, rep, err := unpack(res, dhcpv6.MessageTypeReply)
 		if err != nil {
-			return nil, err
+			return nil, bender.TagError(bender.ErrorClassProtocol, err)
 		}
 		err = validator(solicit, rep)
-		return rep, err
+		return rep, bender.TagError(bender.ErrorClassValidation, err)
 	}
 }
 
@@ -52,14 +52,14 @@ func CreateExecutor(client *async.Client, validator ResponseValidator) bender.Re
 func send(client *async.Client, message dhcpv6.DHCPv6) (dhcpv6.DHCPv6, error) {
 	res, err, timeout := client.Send(message).GetOrTimeout(uint(client.ReadTimeout / time.Millisecond))
 	if timeout {
-		return nil, errors.New("timeout")
+		return nil, bender.TagError(bender.ErrorClassTimeout, errors.New("timeout"))
 	} else if err != nil {
-		return nil, err
+		return nil, bender.TagNetworkError(err)
 	}
 	if res, ok := res.(dhcpv6.DHCPv6); ok {
 		return res, nil
 	}
-	return nil, fmt.Errorf("invalid response type %T, want: dhcpv6.DHCPv6", res)
+	return nil, bender.TagError(bender.ErrorClassProtocol, fmt.Errorf("invalid response type %T, want: dhcpv6.DHCPv6", res))
 }
 
 // unpack extracts the relay inner message and asserts for the expected type,
@@ -105,3 +105,23 @@ func relayRequestFromAdvertise(advertise dhcpv6.DHCPv6) (dhcpv6.DHCPv6, error) {
 	}
 	return dhcpv6.EncapsulateRelay(req, dhcpv6.MessageTypeRelayForward, relay.LinkAddr, relay.PeerAddr)
 }
+
+// LeasedIPExtractor creates an Extractor that returns the IP address (as a net.IP) leased to the
+// client in the IA_NA option of the DHCPv6 reply returned by the executor.
+func LeasedIPExtractor() bender.Extractor {
+	return func(res interface{}) (interface{}, error) {
+		rep, ok := res.(*dhcpv6.Message)
+		if !ok {
+			return nil, fmt.Errorf("invalid response type %T, want: *dhcpv6.Message", res)
+		}
+		iana := rep.Options.OneIANA()
+		if iana == nil {
+			return nil, errors.New("no IA_NA option in response")
+		}
+		addr := iana.Options.OneAddress()
+		if addr == nil {
+			return nil, errors.New("no IA address in response")
+		}
+		return addr.IPv6Addr, nil
+	}
+}
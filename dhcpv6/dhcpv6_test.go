@@ -1,6 +1,7 @@
 package dhcpv6
 
 import (
+	"net"
 	"testing"
 
 	"github.com/insomniacslk/dhcp/dhcpv6"
@@ -17,3 +18,21 @@ func TestExecutorTypeCheck(t *testing.T) {
 		t.Errorf("Expected executor to fail with invalid request type error, got (%s)", err)
 	}
 }
+
+func TestLeasedIPExtractor(t *testing.T) {
+	rep, err := dhcpv6.NewMessage()
+	if err != nil {
+		t.Fatalf("Expected no error when creating reply, got (%v)", err)
+	}
+	if _, err := LeasedIPExtractor()(rep); err == nil || err.Error() != "no IA_NA option in response" {
+		t.Errorf("Expected extractor to fail with no IA_NA error, got (%v)", err)
+	}
+
+	iana := &dhcpv6.OptIANA{}
+	iana.Options.Add(&dhcpv6.OptIAAddress{IPv6Addr: net.ParseIP("2001:db8::1")})
+	rep.AddOption(iana)
+	v, err := LeasedIPExtractor()(rep)
+	if err != nil || !v.(net.IP).Equal(net.ParseIP("2001:db8::1")) {
+		t.Errorf("Actual(%v, %v) != Expected(%v)", v, err, "2001:db8::1")
+	}
+}
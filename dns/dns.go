@@ -2,6 +2,7 @@ package dns
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/miekg/dns"
 	"github.com/pinterest/bender"
@@ -10,8 +11,24 @@ import (
 // ResponseValidator validates a DNS response.
 type ResponseValidator func(request, response *dns.Msg) error
 
-// CreateExecutor creates a new DNS RequestExecutor.
+// CreateExecutor creates a new DNS RequestExecutor, which sends the requests to each of the hosts in
+// turn. Its responses are *dns.Msg values, and the response is returned along with the error if it
+// failed validation.
 func CreateExecutor(client *dns.Client, responseValidator ResponseValidator, hosts ...string) bender.RequestExecutor {
+	return createExecutor(client, responseValidator, false, hosts)
+}
+
+// CreateTaggedExecutor creates a DNS RequestExecutor like CreateExecutor, whose responses are
+// *bender.TaggedResponse values holding the *dns.Msg, tagged with the host (bender.TagTarget) and
+// the type of the first question (bender.TagQType). Requests that fail without a response are tagged
+// as well, with a nil *dns.Msg. The load test unwraps the responses into the Tags of its
+// EndRequestEvents, and code that calls the executor directly gets the *dns.Msg with
+// bender.UnwrapResponse.
+func CreateTaggedExecutor(client *dns.Client, responseValidator ResponseValidator, hosts ...string) bender.RequestExecutor {
+	return createExecutor(client, responseValidator, true, hosts)
+}
+
+func createExecutor(client *dns.Client, responseValidator ResponseValidator, tag bool, hosts []string) bender.RequestExecutor {
 	if client == nil {
 		client = new(dns.Client)
 	}
@@ -24,13 +41,63 @@ func CreateExecutor(client *dns.Client, responseValidator ResponseValidator, hos
 		}
 		addr := hosts[i]
 		i = (i + 1) % len(hosts)
+		response := func(resp *dns.Msg) interface{} {
+			if tag {
+				tags := map[string]string{bender.TagTarget: addr}
+				if len(msg.Question) > 0 {
+					tags[bender.TagQType] = dns.TypeToString[msg.Question[0].Qtype]
+				}
+				return bender.TagResponse(resp, tags)
+			}
+			if resp == nil {
+				return nil
+			}
+			return resp
+		}
+
 		resp, _, err := client.Exchange(msg, addr)
 		if err != nil {
-			return nil, err
+			return response(nil), bender.TagNetworkError(err)
 		}
 		if err = responseValidator(msg, resp); err != nil {
-			return nil, err
+			return response(resp), bender.TagError(rcodeErrorClass(resp.Rcode), err)
+		}
+		return response(resp), nil
+	}
+}
+
+// rcodeErrorClass returns the class of a validation error for a response with the given RCODE.
+func rcodeErrorClass(rcode int) bender.ErrorClass {
+	switch rcode {
+	case dns.RcodeSuccess:
+		return bender.ErrorClassValidation
+	case dns.RcodeServerFailure, dns.RcodeRefused, dns.RcodeNotImplemented:
+		return bender.ErrorClassServer
+	}
+	return bender.ErrorClassClient
+}
+
+// AnswerExtractor creates an Extractor that returns the data of the first record of the given type
+// (dns.TypeA, dns.TypeAAAA, ...) in the answer section of the response. A and AAAA records are
+// returned as a net.IP, and other records as the text of their data, like the target of a CNAME.
+func AnswerExtractor(qtype uint16) bender.Extractor {
+	return func(res interface{}) (interface{}, error) {
+		msg, ok := res.(*dns.Msg)
+		if !ok {
+			return nil, fmt.Errorf("invalid response type %T, want: *dns.Msg", res)
+		}
+		for _, rr := range msg.Answer {
+			if rr.Header().Rrtype != qtype {
+				continue
+			}
+			switch rr := rr.(type) {
+			case *dns.A:
+				return rr.A, nil
+			case *dns.AAAA:
+				return rr.AAAA, nil
+			}
+			return strings.TrimPrefix(rr.String(), rr.Header().String()), nil
 		}
-		return resp, nil
+		return nil, fmt.Errorf("no %s record in answer", dns.TypeToString[qtype])
 	}
 }
@@ -1,9 +1,11 @@
 package dns
 
 import (
+	"net"
 	"testing"
 
 	"github.com/miekg/dns"
+	"github.com/pinterest/bender"
 )
 
 func validator(_, _ *dns.Msg) error {
@@ -17,3 +19,52 @@ func TestExecutorTypeCheck(t *testing.T) {
 		t.Errorf("Expected executor to fail with invalid request type error, got (%s)", err)
 	}
 }
+
+func TestAnswerExtractor(t *testing.T) {
+	resp := new(dns.Msg)
+	cname, _ := dns.NewRR("www.example.com. 300 IN CNAME example.com.")
+	a, _ := dns.NewRR("example.com. 300 IN A 10.0.0.1")
+	resp.Answer = []dns.RR{cname, a}
+
+	v, err := AnswerExtractor(dns.TypeA)(resp)
+	if err != nil || v.(net.IP).String() != "10.0.0.1" {
+		t.Errorf("Actual(%v, %v) != Expected(%v)", v, err, "10.0.0.1")
+	}
+	v, err = AnswerExtractor(dns.TypeCNAME)(resp)
+	if err != nil || v != "example.com." {
+		t.Errorf("Actual(%v, %v) != Expected(%v)", v, err, "example.com.")
+	}
+	if _, err = AnswerExtractor(dns.TypeAAAA)(resp); err == nil || err.Error() != "no AAAA record in answer" {
+		t.Errorf("Expected extractor to fail with no record error, got (%s)", err)
+	}
+}
+
+func TestExecutorTags(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(r)
+		w.WriteMsg(resp)
+	})}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeAAAA)
+	addr := pc.LocalAddr().String()
+	res, err := CreateExecutor(nil, validator, addr)(0, msg)
+	if _, ok := res.(*dns.Msg); err != nil || !ok {
+		t.Errorf("Expected a *dns.Msg, got (%v, %v)", res, err)
+	}
+	res, err = CreateTaggedExecutor(nil, validator, addr)(0, msg)
+	tr, ok := res.(*bender.TaggedResponse)
+	if err != nil || !ok {
+		t.Fatalf("Expected a tagged response, got (%v, %v)", res, err)
+	}
+	if _, ok := tr.Response.(*dns.Msg); !ok || tr.Tags[bender.TagTarget] != addr || tr.Tags[bender.TagQType] != "AAAA" {
+		t.Errorf("Unexpected tagged response %+v", tr)
+	}
+}
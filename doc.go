@@ -99,6 +99,17 @@ number of workers below zero, which will cause undefined behavior from the load
 As with LoadTestThroughput, the load test ends when the request channel is closed and all remaining
 requests have been executed.
 
+LoadTestVirtualUsers
+
+LoadTestVirtualUsers is a closed-loop load test that models a fixed number of interactive clients
+more faithfully than LoadTestConcurrency. Each virtual user runs in its own goroutine, takes a
+request from the channel, executes it and then sleeps for a think time drawn from an
+IntervalGenerator before taking the next one, just as a real user would pause between clicks. A
+second, optional, IntervalGenerator paces each user: it gives the minimum time between the starts
+of consecutive iterations, so UniformIntervalGenerator(0.5) runs each user at most once every two
+seconds, no matter how quickly the service responds. When the request channel is closed, each user
+sends a UserEndEvent with the number of iterations it completed.
+
 Interval Generators
 
 An IntervalGenerator is a function that takes the current Unix epoch time (in nanoseconds) and
@@ -153,6 +164,29 @@ request.
 
 RequestExecutors are called concurrently from multiple goroutines, and must be concurrency-safe.
 
+Sessions
+
+Many services can only be tested realistically with a sequence of requests from the same user, for
+example logging in, fetching a feed and then posting to it. NewSessionExecutor creates a
+RequestExecutor that runs a scripted list of SessionSteps, with optional think times between them,
+for each request. The requests sent to a session executor are *Session values, which hold the
+state shared by the steps, like auth tokens and IDs taken from earlier responses:
+
+ exec := bender.NewSessionExecutor(recorder,
+     bender.SessionStep{Name: "login", Request: login, Exec: httpExec, Response: saveToken},
+     bender.SessionStep{Name: "feed", Request: feed, Exec: httpExec, Think: think})
+
+Values can be pulled out of a step's response with the Extractors in its Extract map, which save
+them as session variables for later steps to use, for example with Session.Expand. The protocol
+packages provide extractors for their responses, like http.JSONPathExtractor and
+dns.AnswerExtractor, so a step that creates an object can pass its ID to a step that reads it:
+
+ bender.SessionStep{Name: "create", Request: create, Exec: httpExec,
+     Extract: map[string]bender.Extractor{"id": http.JSONPathExtractor("$.id")}}
+
+Each step sends a StartStepEvent and an EndStepEvent to the recorder channel, and the load tester
+sends the usual EndRequestEvent for the session as a whole.
+
 Event Messages
 
 The LoadTestThroughput and LoadTestConcurrency functions both take a channel of events (represented
@@ -170,7 +204,21 @@ event time. Note that the event time is not the same as the start time for the r
 stupid performance reasons. If you need to know the actual start time, see the EndRequestEvent.
 
 EndRequestEvent: sent after a request has finished, includes the response, the actual start and
-end times for the request and any error returned by the RequestExecutor.
+end times for the request and any error returned by the RequestExecutor. The protocol executors tag
+their errors with an ErrorClass (timeout, connection refused, server error, validation failure and
+so on), which recorders can get with the event's ErrorClass method. The tagged executors of the
+protocol packages, like http.CreateTaggedExecutor, return a TaggedResponse, which the load test
+unwraps into the Response and Tags of the event, with the host that served the request and,
+depending on the protocol, the DNS query type or the HTTP method and route. TagExecutor adds tags of
+your own, like the name of a scenario. The plain executors, like http.CreateExecutor, return the
+protocol's own responses, like *http.Response, so code that calls a tagged executor directly must
+unwrap its responses with UnwrapResponse. The tagged HTTP executor also times the phases of each
+request (the DNS lookup, connection, TLS handshake, time to first byte and body read), which are in
+the Phases of the event, and NewPhaseRecorder reports the percentiles of each phase, to tell a slow
+server from churning connections.
+
+UserEndEvent: sent only for LoadTestVirtualUsers, once for each virtual user when it stops, includes
+the number of iterations the user completed.
 
 The WaitEvent includes the time until the next request is sent (in nanoseconds) and an "overage"
 time. When the inner loop sleeps, it subtracts the total time slept from the time it intended to
@@ -183,5 +231,86 @@ The event channel doesn't need to be buffered, but it may help if you find that
 as much throughput as you expect. In general, this depends a lot on how quickly you are consuming
 events from the channel, and how quickly the load tester is running. It is a good practice to
 proactively buffer this channel.
+
+At very high throughput, the events themselves become the bottleneck. The load test functions take
+options to sample or disable the per-request and wait events, and to aggregate the latency of every
+request in histograms inside the load test instead, which are sent as a HistogramEvent every
+interval. The histogram and windowed recorders use those in place of the EndRequestEvents:
+
+ bender.LoadTestThroughput(intervals, requests, exec, recorder,
+     bender.WithAggregation(newHist, time.Second),
+     bender.WithRequestEventSampling(0.001),
+     bender.WithWaitEventSampling(0))
+
+Recorders that work from the individual EndRequestEvents, like the metrics, dashboard, breakdown and
+exemplar recorders, only see the sampled requests, so their counts and rates are too low by the
+sampling rate. The EventLogWriter logs the HistogramEvents, so that replaying the log gives the
+same histograms.
+
+Recorders
+
+The Record function reads events from the channel and passes each of them to a list of Recorders,
+which are functions that take an event. NewLoggingRecorder logs every event, and
+NewHistogramRecorder adds the latency of each request to a hist.Histogram for a summary of the whole
+load test. NewWindowedRecorder splits the load test into fixed windows of time, with the throughput,
+error rate, latency histogram and overage of each, so that problems that only last part of a long
+load test are still visible:
+
+ ws := bender.NewWindowedStats(10*time.Second, func() *hist.Histogram {
+     return hist.NewLogHistogram(3, int(time.Millisecond))
+ })
+ bender.Record(recorder, bender.NewHistogramRecorder(h), bender.NewWindowedRecorder(ws))
+ ws.WriteCSV(os.Stdout, 0.5, 0.99)
+
+If the maximum overage of the windows grows while their throughput drops, the load tester, rather
+than the service, was the bottleneck.
+
+NewBreakdownRecorder keeps a histogram for each combination of the values of a set of tags, which
+are set by the tagged executors, so that one slow host or route stands out:
+
+ b := bender.NewBreakdown(newHist, bender.TagTarget, bender.TagQType)
+ bender.Record(recorder, bender.NewBreakdownRecorder(b))
+ b.WriteTable(os.Stdout, 0.5, 0.99)
+
+NewExemplarRecorder keeps the slowest requests of the load test and a sample of the failed ones,
+with summaries of their requests and responses, so that the tail of the histogram can be traced
+back to actual requests. The exemplars can be added to a hist.Summary for its JSON output, and to a
+report:
+
+ var e hist.Exemplars
+ bender.Record(recorder, bender.NewHistogramRecorder(h), bender.NewExemplarRecorder(&e, 10, 10, nil))
+ e.WriteText(os.Stdout)
+
+An EventLogWriter writes every event to a compact binary or JSONL log, and ReplayEventLog passes the
+events in a log to any set of recorders, so that reports can be recomputed later, with different
+settings, without running the load test again. The report package turns windowed stats, or an event
+log, into a self-contained HTML report with charts of the latency and throughput over time. The
+compare package, and the bender-compare command, compare saved results of two runs of a load test
+and flag regressions of the latency percentiles or error rate. The slo package checks the results of
+a load test against assertions like "p99 < 250ms" or "error% < 0.1", and writes the results as JUnit
+XML for CI systems. The trace package propagates a W3C traceparent in a sample of the requests and
+exports a client span for each of them with OTLP, so that the slowest requests of a load test can be
+found in the traces of the service.
+
+The health package samples the load generator itself during a load test, with its garbage
+collection pauses, heap size, goroutines, CPU usage and scheduling lag, and warns about the windows
+in which it likely skewed the latencies:
+
+ m := health.NewMonitor(time.Second)
+ bender.Record(recorder, bender.NewWindowedRecorder(ws), m.Record)
+ warnings := health.Check(m.Samples(), ws, nil)
+
+Record calls the recorders one after the other, on one goroutine, so a slow recorder backs up the
+event channel and eventually slows down the load test itself. RecordAsync runs each recorder on its
+own goroutine with a buffered queue instead, and can drop (and count) the events for a recorder
+that falls behind, rather than block:
+
+ dropped := bender.RecordAsync(recorder, 10000, bender.OverflowDrop, recorders...)
+
+NewDashboardRecorder shows the progress of a running load test, with the throughput, error rate by
+class, recent latency percentiles and overage. On a terminal it redraws a status panel in place, and
+otherwise it writes one line per interval:
+
+ bender.Record(recorder, bender.NewDashboardRecorder(os.Stdout, time.Second, qps))
 */
 package bender
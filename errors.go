@@ -0,0 +1,130 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bender
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+)
+
+// ErrorClass is the category of an error returned by a RequestExecutor.
+type ErrorClass string
+
+// The error classes used by the protocol executors.
+const (
+	// The request or response timed out.
+	ErrorClassTimeout ErrorClass = "timeout"
+	// The connection to the service was refused.
+	ErrorClassConnRefused ErrorClass = "connection_refused"
+	// The name of the service couldn't be resolved.
+	ErrorClassDNS ErrorClass = "dns"
+	// Any other failure to send the request or receive the response.
+	ErrorClassNetwork ErrorClass = "network"
+	// The response couldn't be decoded, or was not the expected message.
+	ErrorClassProtocol ErrorClass = "protocol"
+	// The response was rejected by the validator.
+	ErrorClassValidation ErrorClass = "validation"
+	// The service rejected the request, like an HTTP 4xx status or a DNS NXDOMAIN.
+	ErrorClassClient ErrorClass = "client_error"
+	// The service failed to handle the request, like an HTTP 5xx status or a DNS SERVFAIL.
+	ErrorClassServer ErrorClass = "server_error"
+	// The error couldn't be classified.
+	ErrorClassOther ErrorClass = "other"
+)
+
+// ClassifiedError is an error tagged with its ErrorClass.
+type ClassifiedError struct {
+	Class ErrorClass
+	Err   error
+}
+
+func (e *ClassifiedError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *ClassifiedError) Unwrap() error {
+	return e.Err
+}
+
+// TagError tags the error with the given class, or returns nil if err is nil.
+func TagError(class ErrorClass, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ClassifiedError{class, err}
+}
+
+// TagNetworkError tags an error returned while sending a request or receiving its response with
+// its network class (timeout, connection refused, DNS or network), or with ErrorClassProtocol if it
+// isn't a network error. Errors that are already tagged are returned unchanged.
+func TagNetworkError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var ce *ClassifiedError
+	if errors.As(err, &ce) {
+		return err
+	}
+	class := networkErrorClass(err)
+	if class == ErrorClassOther {
+		class = ErrorClassProtocol
+	}
+	return &ClassifiedError{class, err}
+}
+
+// ClassifyError returns the class the error was tagged with or, for untagged errors, the class of
+// the standard library network error it wraps, if any. It returns ErrorClassOther for any other
+// error, and the empty class for nil.
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ""
+	}
+	var ce *ClassifiedError
+	if errors.As(err, &ce) {
+		return ce.Class
+	}
+	return networkErrorClass(err)
+}
+
+func networkErrorClass(err error) ErrorClass {
+	var timeout interface{ Timeout() bool }
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) ||
+		(errors.As(err, &timeout) && timeout.Timeout()) {
+		return ErrorClassTimeout
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return ErrorClassConnRefused
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrorClassDNS
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return ErrorClassNetwork
+	}
+	return ErrorClassOther
+}
+
+// ErrorClass returns the class of the event's error, or the empty class if the request succeeded.
+func (e *EndRequestEvent) ErrorClass() ErrorClass {
+	return ClassifyError(e.Err)
+}
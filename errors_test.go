@@ -0,0 +1,60 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bender
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		err   error
+		class ErrorClass
+	}{
+		{nil, ""},
+		{errors.New("fake error"), ErrorClassOther},
+		{TagError(ErrorClassServer, errors.New("500")), ErrorClassServer},
+		{fmt.Errorf("wrapped: %w", TagError(ErrorClassValidation, errors.New("bad"))), ErrorClassValidation},
+		{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, ErrorClassConnRefused},
+		{&net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, ErrorClassTimeout},
+		{&net.DNSError{Err: "no such host", Name: "example.invalid"}, ErrorClassDNS},
+		{&net.OpError{Op: "read", Err: errors.New("broken")}, ErrorClassNetwork},
+	}
+	for _, c := range cases {
+		if class := ClassifyError(c.err); class != c.class {
+			t.Errorf("ClassifyError(%v) == %q (should be %q)", c.err, class, c.class)
+		}
+	}
+}
+
+func TestTagNetworkError(t *testing.T) {
+	if TagNetworkError(nil) != nil {
+		t.Error("Expected nil error to stay nil")
+	}
+	if class := ClassifyError(TagNetworkError(errors.New("bad frame"))); class != ErrorClassProtocol {
+		t.Errorf("Actual(%q) != Expected(%q)", class, ErrorClassProtocol)
+	}
+	err := TagNetworkError(TagError(ErrorClassServer, errors.New("500")))
+	if class := ClassifyError(err); class != ErrorClassServer {
+		t.Errorf("Actual(%q) != Expected(%q)", class, ErrorClassServer)
+	}
+}
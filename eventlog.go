@@ -0,0 +1,473 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bender
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/pinterest/bender/hist"
+)
+
+// EventLogFormat is the format of an event log.
+type EventLogFormat int
+
+// The event log formats.
+const (
+	// EventLogBinary is a compact binary format, with varint-encoded times.
+	EventLogBinary EventLogFormat = iota
+	// EventLogJSON writes one JSON object per line (JSONL).
+	EventLogJSON
+)
+
+// eventLogMagic starts every binary event log, and is followed by the format version.
+var eventLogMagic = []byte("BEVL")
+
+// eventLogVersion is the version of the binary format written by an EventLogWriter.
+const eventLogVersion = 1
+
+// The types of the logged events, which are the first byte of each event in the binary format.
+const (
+	logStart byte = iota + 1
+	logEnd
+	logWait
+	logStartRequest
+	logEndRequest
+	logHistogram
+)
+
+var logTypeNames = map[byte]string{
+	logStart:        "start",
+	logEnd:          "end",
+	logWait:         "wait",
+	logStartRequest: "start_request",
+	logEndRequest:   "end_request",
+	logHistogram:    "histogram",
+}
+
+// loggedEvent holds the fields of any logged event, and is the JSON encoding of each event.
+type loggedEvent struct {
+	Type       string `json:"type"`
+	Start      int64  `json:"start,omitempty"`
+	End        int64  `json:"end,omitempty"`
+	Time       int64  `json:"time,omitempty"`
+	Wait       int64  `json:"wait,omitempty"`
+	Overage    int64  `json:"overage,omitempty"`
+	Request    string `json:"request,omitempty"`
+	Response   string `json:"response,omitempty"`
+	ErrorClass string `json:"error_class,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// The tags of the EndRequestEvent, and the durations of its phases in nanoseconds.
+	Tags   map[string]string `json:"tags,omitempty"`
+	Phases map[string]int64  `json:"phases,omitempty"`
+	// The Aggregated flag and empty histogram of the StartEvent, and the histogram of the
+	// HistogramEvent.
+	Aggregated bool            `json:"aggregated,omitempty"`
+	Hist       *hist.Histogram `json:"hist,omitempty"`
+}
+
+// EventLogWriter writes the events of a load test to a log, which can be replayed through other
+// recorders later with ReplayEventLog, for example to compute reports with different histogram
+// settings without running the load test again. Its Record method is a Recorder:
+//
+//	l := bender.NewEventLogWriter(f, bender.EventLogBinary, nil)
+//	bender.Record(recorder, l.Record, bender.NewHistogramRecorder(h))
+//	if err := l.Err(); err != nil { ... }
+//
+// The log is buffered, and is flushed after the EndEvent, or by calling Flush.
+type EventLogWriter struct {
+	w         *bufio.Writer
+	format    EventLogFormat
+	summarize func(interface{}) string
+	started   bool
+	err       error
+}
+
+// NewEventLogWriter creates an EventLogWriter that writes to w in the given format. If summarize
+// is not nil, it is called to create a short summary of each request and response for the log.
+func NewEventLogWriter(w io.Writer, format EventLogFormat, summarize func(interface{}) string) *EventLogWriter {
+	return &EventLogWriter{w: bufio.NewWriter(w), format: format, summarize: summarize}
+}
+
+// Err returns the first error encountered while writing the log, if any.
+func (l *EventLogWriter) Err() error {
+	return l.err
+}
+
+// Flush writes any buffered events to the underlying writer.
+func (l *EventLogWriter) Flush() error {
+	if l.err == nil {
+		l.err = l.w.Flush()
+	}
+	return l.err
+}
+
+func (l *EventLogWriter) summary(v interface{}) string {
+	if l.summarize == nil || v == nil {
+		return ""
+	}
+	return l.summarize(v)
+}
+
+// Record writes an event to the log. Events other than the StartEvent, EndEvent, WaitEvent,
+// StartRequestEvent, EndRequestEvent and HistogramEvent are ignored. The HistogramEvents of a load
+// test with aggregation are logged, so that replaying the log gives the same histograms even when
+// the EndRequestEvents were sampled.
+func (l *EventLogWriter) Record(msg interface{}) {
+	if l.err != nil {
+		return
+	}
+
+	var e loggedEvent
+	var t byte
+	switch msg := msg.(type) {
+	case *StartEvent:
+		t, e.Start, e.Aggregated, e.Hist = logStart, msg.Start, msg.Aggregated, msg.Hist
+	case *EndEvent:
+		t, e.Start, e.End = logEnd, msg.Start, msg.End
+	case *WaitEvent:
+		t, e.Wait, e.Overage, e.Time = logWait, msg.Wait, msg.Overage, msg.Time
+	case *StartRequestEvent:
+		t, e.Time, e.Request = logStartRequest, msg.Time, l.summary(msg.Request)
+	case *EndRequestEvent:
+		t, e.Start, e.End, e.Response = logEndRequest, msg.Start, msg.End, l.summary(msg.Response)
+		if msg.Err != nil {
+			e.ErrorClass, e.Error = string(msg.ErrorClass()), msg.Err.Error()
+		}
+		e.Tags = msg.Tags
+		if len(msg.Phases) > 0 {
+			e.Phases = make(map[string]int64, len(msg.Phases))
+			for name, d := range msg.Phases {
+				e.Phases[name] = int64(d)
+			}
+		}
+	case *HistogramEvent:
+		t, e.Start, e.End, e.Hist = logHistogram, msg.Start, msg.End, msg.Hist
+	default:
+		return
+	}
+	e.Type = logTypeNames[t]
+
+	if l.format == EventLogJSON {
+		var data []byte
+		if data, l.err = json.Marshal(&e); l.err == nil {
+			data = append(data, '\n')
+			_, l.err = l.w.Write(data)
+		}
+	} else {
+		l.writeBinary(t, &e)
+	}
+
+	if t == logEnd {
+		l.Flush()
+	}
+}
+
+func (l *EventLogWriter) writeBinary(t byte, e *loggedEvent) {
+	var buf []byte
+	if !l.started {
+		buf = append(buf, eventLogMagic...)
+		buf = append(buf, eventLogVersion)
+		l.started = true
+	}
+	buf = append(buf, t)
+
+	var b [binary.MaxVarintLen64]byte
+	putVarint := func(v int64) {
+		buf = append(buf, b[:binary.PutVarint(b[:], v)]...)
+	}
+	putUvarint := func(v uint64) {
+		buf = append(buf, b[:binary.PutUvarint(b[:], v)]...)
+	}
+	putString := func(s string) {
+		putUvarint(uint64(len(s)))
+		buf = append(buf, s...)
+	}
+
+	switch t {
+	case logStart:
+		putVarint(e.Start)
+		// The flags are 1 if the load test is aggregated, and 2 if the event has a histogram.
+		var flags byte
+		if e.Aggregated {
+			flags |= 1
+		}
+		if e.Hist != nil {
+			flags |= 2
+		}
+		buf = append(buf, flags)
+		if e.Hist != nil {
+			data, err := e.Hist.MarshalBinary()
+			if err != nil {
+				l.err = err
+				return
+			}
+			putString(string(data))
+		}
+	case logEnd:
+		putVarint(e.Start)
+		putVarint(e.End)
+	case logWait:
+		putVarint(e.Wait)
+		putVarint(e.Overage)
+		putVarint(e.Time)
+	case logStartRequest:
+		putVarint(e.Time)
+		putString(e.Request)
+	case logEndRequest:
+		putVarint(e.Start)
+		putVarint(e.End)
+		putString(e.Response)
+		putString(e.ErrorClass)
+		putString(e.Error)
+		putUvarint(uint64(len(e.Tags)))
+		for _, k := range sortedKeys(e.Tags) {
+			putString(k)
+			putString(e.Tags[k])
+		}
+		names := make([]string, 0, len(e.Phases))
+		for name := range e.Phases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		putUvarint(uint64(len(names)))
+		for _, name := range names {
+			putString(name)
+			putVarint(e.Phases[name])
+		}
+	case logHistogram:
+		putVarint(e.Start)
+		putVarint(e.End)
+		data, err := e.Hist.MarshalBinary()
+		if err != nil {
+			l.err = err
+			return
+		}
+		putString(string(data))
+	}
+	_, l.err = l.w.Write(buf)
+}
+
+// event converts a logged event back into the event that was logged. Requests and responses are
+// replaced by their summaries (or nil if they weren't summarized) and errors by errors with the same
+// message and class.
+func (e *loggedEvent) event() (interface{}, error) {
+	switch e.Type {
+	case "start":
+		return &StartEvent{Start: e.Start, Aggregated: e.Aggregated, Hist: e.Hist}, nil
+	case "end":
+		return &EndEvent{e.Start, e.End}, nil
+	case "wait":
+		return &WaitEvent{e.Wait, e.Overage, e.Time}, nil
+	case "start_request":
+		return &StartRequestEvent{e.Time, optional(e.Request)}, nil
+	case "end_request":
+		var err error
+		if e.ErrorClass != "" || e.Error != "" {
+			err = TagError(ErrorClass(e.ErrorClass), errors.New(e.Error))
+		}
+		msg := &EndRequestEvent{Start: e.Start, End: e.End, Response: optional(e.Response), Err: err, Tags: e.Tags}
+		if len(e.Phases) > 0 {
+			msg.Phases = make(map[string]time.Duration, len(e.Phases))
+			for name, d := range e.Phases {
+				msg.Phases[name] = time.Duration(d)
+			}
+		}
+		return msg, nil
+	case "histogram":
+		if e.Hist == nil {
+			return nil, errors.New("histogram event without a histogram")
+		}
+		return &HistogramEvent{e.Start, e.End, e.Hist}, nil
+	}
+	return nil, fmt.Errorf("unknown event type %q", e.Type)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func optional(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// ReplayEventLog reads an event log written by an EventLogWriter, in either format, and passes each
+// event to the recorders in order, just like Record. It returns an error if the log is truncated or
+// corrupt, after replaying the events before the error.
+func ReplayEventLog(r io.Reader, recorders ...Recorder) error {
+	br := bufio.NewReader(r)
+	next := readJSONEvent
+	if magic, _ := br.Peek(len(eventLogMagic)); bytes.Equal(magic, eventLogMagic) {
+		br.Discard(len(eventLogMagic))
+		v, err := br.ReadByte()
+		if err != nil || v != eventLogVersion {
+			return fmt.Errorf("unsupported event log version %d", v)
+		}
+		next = readBinaryEvent
+	}
+
+	for {
+		e, err := next(br)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		msg, err := e.event()
+		if err != nil {
+			return err
+		}
+		for _, recorder := range recorders {
+			recorder(msg)
+		}
+	}
+}
+
+func readJSONEvent(r *bufio.Reader) (*loggedEvent, error) {
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) == 0 {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var e loggedEvent
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, err
+		}
+		return &e, nil
+	}
+}
+
+// maxLoggedHistogram is the largest encoded histogram read from a binary event log.
+const maxLoggedHistogram = 64 << 20
+
+// readBinaryEvent reads an event from a binary log.
+func readBinaryEvent(r *bufio.Reader) (*loggedEvent, error) {
+	t, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	e := &loggedEvent{Type: logTypeNames[t]}
+
+	getVarint := func() int64 {
+		if err != nil {
+			return 0
+		}
+		var v int64
+		v, err = binary.ReadVarint(r)
+		return v
+	}
+	getBytes := func(max uint64) []byte {
+		if err != nil {
+			return nil
+		}
+		var n uint64
+		if n, err = binary.ReadUvarint(r); err != nil {
+			return nil
+		}
+		if n > max {
+			err = errors.New("event log string too long")
+			return nil
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(r, b)
+		return b
+	}
+	getString := func() string {
+		return string(getBytes(1 << 20))
+	}
+	// getCount reads the number of entries of a map, which can't be more than the bytes left in a
+	// sane log.
+	getCount := func() int {
+		if err != nil {
+			return 0
+		}
+		var n uint64
+		if n, err = binary.ReadUvarint(r); err == nil && n > 1<<16 {
+			err = errors.New("event log map too large")
+		}
+		return int(n)
+	}
+
+	switch t {
+	case logStart:
+		e.Start = getVarint()
+		var flags byte
+		if err == nil {
+			flags, err = r.ReadByte()
+			e.Aggregated = flags&1 != 0
+		}
+		if flags&2 != 0 {
+			if data := getBytes(maxLoggedHistogram); err == nil {
+				e.Hist = new(hist.Histogram)
+				err = e.Hist.UnmarshalBinary(data)
+			}
+		}
+	case logEnd:
+		e.Start, e.End = getVarint(), getVarint()
+	case logWait:
+		e.Wait, e.Overage, e.Time = getVarint(), getVarint(), getVarint()
+	case logStartRequest:
+		e.Time, e.Request = getVarint(), getString()
+	case logEndRequest:
+		e.Start, e.End = getVarint(), getVarint()
+		e.Response, e.ErrorClass, e.Error = getString(), getString(), getString()
+		if n := getCount(); n > 0 {
+			e.Tags = make(map[string]string, n)
+			for i := 0; i < n && err == nil; i++ {
+				k := getString()
+				e.Tags[k] = getString()
+			}
+		}
+		if n := getCount(); n > 0 {
+			e.Phases = make(map[string]int64, n)
+			for i := 0; i < n && err == nil; i++ {
+				name := getString()
+				e.Phases[name] = getVarint()
+			}
+		}
+	case logHistogram:
+		e.Start, e.End = getVarint(), getVarint()
+		if data := getBytes(maxLoggedHistogram); err == nil {
+			e.Hist = new(hist.Histogram)
+			err = e.Hist.UnmarshalBinary(data)
+		}
+	default:
+		return nil, fmt.Errorf("unknown event type %d", t)
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return e, err
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bender
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testEvents() []interface{} {
+	return []interface{}{
+		&StartEvent{Start: 100},
+		&WaitEvent{10, 2, 110},
+		&StartRequestEvent{120, "GET /"},
+		&EndRequestEvent{Start: 125, End: 200, Response: 200, Tags: map[string]string{TagTarget: "a:80", TagRoute: "/"},
+			Phases: map[string]time.Duration{PhaseConnect: 20, PhaseTTFB: 50}},
+		&StartRequestEvent{210, "GET /missing"},
+		&EndRequestEvent{Start: 215, End: 250, Err: TagError(ErrorClassClient, errors.New("404 Not Found"))},
+		&EndEvent{100, 300},
+	}
+}
+
+func TestEventLogRoundTrip(t *testing.T) {
+	for _, format := range []EventLogFormat{EventLogBinary, EventLogJSON} {
+		var b bytes.Buffer
+		l := NewEventLogWriter(&b, format, func(v interface{}) string { return fmt.Sprint(v) })
+		for _, msg := range testEvents() {
+			l.Record(msg)
+		}
+		if l.Err() != nil {
+			t.Fatalf("Expected no error, got (%v)", l.Err())
+		}
+
+		var replayed []interface{}
+		if err := ReplayEventLog(&b, func(msg interface{}) { replayed = append(replayed, msg) }); err != nil {
+			t.Fatalf("Expected no error, got (%v)", err)
+		}
+		expected := testEvents()
+		expected[3].(*EndRequestEvent).Response = "200"
+		if len(replayed) != len(expected) {
+			t.Fatalf("Expected %d events, got %d", len(expected), len(replayed))
+		}
+		for i := range expected {
+			if i == 5 {
+				continue
+			}
+			if !reflect.DeepEqual(replayed[i], expected[i]) {
+				t.Errorf("Replayed %+v != Logged %+v", replayed[i], expected[i])
+			}
+		}
+		end := replayed[5].(*EndRequestEvent)
+		if end.Err.Error() != "404 Not Found" || end.ErrorClass() != ErrorClassClient || end.Response != nil {
+			t.Errorf("Unexpected replayed error event %+v", end)
+		}
+	}
+}
+
+func TestEventLogTruncated(t *testing.T) {
+	var b bytes.Buffer
+	l := NewEventLogWriter(&b, EventLogBinary, nil)
+	for _, msg := range testEvents() {
+		l.Record(msg)
+	}
+
+	count := 0
+	err := ReplayEventLog(bytes.NewReader(b.Bytes()[:b.Len()-2]), func(interface{}) { count++ })
+	if err == nil || count != 6 {
+		t.Errorf("Expected an error after replaying 6 events, got %d events and (%v)", count, err)
+	}
+}
+
+func TestEventLogAggregated(t *testing.T) {
+	for _, format := range []EventLogFormat{EventLogBinary, EventLogJSON} {
+		cr := make(chan interface{})
+		LoadTestConcurrency(workers(2), manyRequests(50), errorExec, cr,
+			WithRequestEventSampling(0), WithAggregation(newTestHist, 0))
+
+		var b bytes.Buffer
+		l := NewEventLogWriter(&b, format, nil)
+		h := newTestHist()
+		Record(cr, l.Record, NewHistogramRecorder(h))
+		if l.Err() != nil {
+			t.Fatalf("Expected no error, got (%v)", l.Err())
+		}
+
+		replayed := newTestHist()
+		var start *StartEvent
+		if err := ReplayEventLog(&b, NewHistogramRecorder(replayed), func(msg interface{}) {
+			if e, ok := msg.(*StartEvent); ok {
+				start = e
+			}
+		}); err != nil {
+			t.Fatalf("Expected no error, got (%v)", err)
+		}
+		if start == nil || !start.Aggregated || start.Hist == nil || start.Hist.Count() != 0 {
+			t.Errorf("Expected an aggregated StartEvent with an empty histogram, got %+v", start)
+		}
+		if h.Count() != 50 || replayed.Count() != h.Count() || replayed.Errors() != h.Errors() {
+			t.Errorf("Expected %d replayed requests, got %d", h.Count(), replayed.Count())
+		}
+	}
+}
+
+func TestEventLogVersion(t *testing.T) {
+	log := append([]byte("BEVL"), eventLogVersion+1, logEnd, 200, 1, 144, 3)
+	if err := ReplayEventLog(bytes.NewReader(log)); err == nil || err.Error() != "unsupported event log version 2" {
+		t.Errorf("Expected an unsupported version error, got (%v)", err)
+	}
+}
+
+func TestEventLogReplayBreakdownAndPhases(t *testing.T) {
+	for _, format := range []EventLogFormat{EventLogBinary, EventLogJSON} {
+		var b bytes.Buffer
+		l := NewEventLogWriter(&b, format, nil)
+		for _, msg := range testEvents() {
+			l.Record(msg)
+		}
+
+		bd := NewBreakdown(newTestHist, TagTarget)
+		ps := NewPhaseStats(newTestHist)
+		if err := ReplayEventLog(&b, NewBreakdownRecorder(bd), NewPhaseRecorder(ps)); err != nil {
+			t.Fatalf("Expected no error, got (%v)", err)
+		}
+		groups := bd.Sorted()
+		if len(groups) != 2 || groups[0].Values[0] != "" || groups[1].Values[0] != "a:80" || groups[1].Hist.Count() != 1 {
+			t.Errorf("Expected an untagged and an a:80 group, got %+v", groups)
+		}
+		if ps.Requests != 2 || len(ps.Hists) != 2 || ps.Hists[PhaseConnect].Count() != 1 {
+			t.Errorf("Unexpected replayed phases %+v", ps.Hists)
+		}
+	}
+}
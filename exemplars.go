@@ -0,0 +1,96 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bender
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/pinterest/bender/hist"
+)
+
+// maxSummaryLen is the length at which the default summaries of requests and responses are cut off.
+const maxSummaryLen = 120
+
+// defaultSummary formats a request or response with fmt, cut off at maxSummaryLen runes.
+func defaultSummary(v interface{}) string {
+	s := []rune(fmt.Sprint(v))
+	if len(s) > maxSummaryLen {
+		return string(s[:maxSummaryLen]) + "..."
+	}
+	return string(s)
+}
+
+// NewExemplarRecorder creates a new recorder that keeps the given number of slowest requests of the
+// load test in e.Slowest, slowest first, and a uniform random sample of the given number of failed
+// requests in e.Errors. The requests and responses are described by summarize, which should return
+// a short string, like the method and URL of an HTTP request, or are formatted with fmt and cut off
+// if it is nil. Only the requests that were sent in an EndRequestEvent are considered, so sampling
+// the events with WithRequestEventSampling also samples the exemplars.
+func NewExemplarRecorder(e *hist.Exemplars, slowest, errors int, summarize func(interface{}) string) Recorder {
+	if summarize == nil {
+		summarize = defaultSummary
+	}
+	exemplar := func(msg *EndRequestEvent) hist.Exemplar {
+		x := hist.Exemplar{Start: msg.Start, End: msg.End, Latency: time.Duration(msg.End - msg.Start), Target: msg.Tags[TagTarget]}
+		if msg.Request != nil {
+			x.Request = summarize(msg.Request)
+		}
+		if msg.Response != nil {
+			x.Response = summarize(msg.Response)
+		}
+		if msg.Err != nil {
+			x.ErrorClass, x.Error = string(msg.ErrorClass()), msg.Err.Error()
+		}
+		return x
+	}
+
+	failed := 0
+	return func(msg interface{}) {
+		switch msg := msg.(type) {
+		case *StartEvent:
+			e.Slowest, e.Errors, failed = nil, nil, 0
+		case *EndRequestEvent:
+			latency := time.Duration(msg.End - msg.Start)
+			i := sort.Search(len(e.Slowest), func(i int) bool {
+				return e.Slowest[i].Latency < latency
+			})
+			if i < slowest {
+				e.Slowest = append(e.Slowest, hist.Exemplar{})
+				copy(e.Slowest[i+1:], e.Slowest[i:])
+				e.Slowest[i] = exemplar(msg)
+				if len(e.Slowest) > slowest {
+					e.Slowest = e.Slowest[:slowest]
+				}
+			}
+
+			if msg.Err == nil || errors <= 0 {
+				return
+			}
+			failed++
+			if len(e.Errors) < errors {
+				e.Errors = append(e.Errors, exemplar(msg))
+			} else if j := rand.Intn(failed); j < errors {
+				// Replace a random exemplar, and keep the rest in the order they finished.
+				copy(e.Errors[j:], e.Errors[j+1:])
+				e.Errors[errors-1] = exemplar(msg)
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bender
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pinterest/bender/hist"
+)
+
+func TestExemplarRecorder(t *testing.T) {
+	var e hist.Exemplars
+	r := NewExemplarRecorder(&e, 3, 2, nil)
+	ms := int64(time.Millisecond)
+	r(&StartEvent{Start: 0})
+	for i := int64(0); i < 10; i++ {
+		msg := &EndRequestEvent{Start: i * ms, End: i*ms + (i%5+1)*ms, Request: i, Response: strings.Repeat("x", 200),
+			Tags: map[string]string{TagTarget: "a:53"}}
+		if i%2 == 1 {
+			msg.Response, msg.Err = nil, TagError(ErrorClassServer, errors.New("unavailable"))
+		}
+		r(msg)
+	}
+	r(&EndEvent{Start: 0, End: 20 * ms})
+
+	if len(e.Slowest) != 3 {
+		t.Fatalf("Expected 3 slowest requests, got %d", len(e.Slowest))
+	}
+	for i, latency := range []time.Duration{5 * time.Millisecond, 5 * time.Millisecond, 4 * time.Millisecond} {
+		if e.Slowest[i].Latency != latency {
+			t.Errorf("Actual(%v) != Expected(%v) for slowest request %d", e.Slowest[i].Latency, latency, i)
+		}
+	}
+	if x := e.Slowest[0]; x.Request != "4" || x.Target != "a:53" || len(x.Response) != maxSummaryLen+3 || x.Error != "" {
+		t.Errorf("Unexpected slowest request %+v", x)
+	}
+
+	if len(e.Errors) != 2 {
+		t.Fatalf("Expected 2 failed requests, got %d", len(e.Errors))
+	}
+	if x := e.Errors[0]; x.ErrorClass != string(ErrorClassServer) || x.Error != "unavailable" || x.Response != "" {
+		t.Errorf("Unexpected failed request %+v", x)
+	}
+	if e.Errors[0].Start >= e.Errors[1].Start {
+		t.Errorf("Expected the failed requests in the order they finished")
+	}
+
+	r(&StartEvent{Start: 0})
+	if len(e.Slowest) != 0 || len(e.Errors) != 0 {
+		t.Errorf("Expected the exemplars to be reset by the StartEvent")
+	}
+}
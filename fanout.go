@@ -0,0 +1,156 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bender
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy is what a FanOut does with an event when a recorder's queue is full.
+type OverflowPolicy int
+
+// The overflow policies.
+const (
+	// OverflowBlock waits for room in the queue, so that no events are lost, but a recorder that
+	// can't keep up eventually slows down the load test.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDrop drops the event for that recorder, and counts it, so that a slow recorder can never
+	// slow down the load test.
+	OverflowDrop
+)
+
+// flushMarker is queued for each recorder to wait until it has handled the events before it.
+type flushMarker struct {
+	wg *sync.WaitGroup
+}
+
+type recorderQueue struct {
+	recorder Recorder
+	events   chan interface{}
+	dropped  int64
+	done     chan struct{}
+}
+
+func (q *recorderQueue) run() {
+	defer close(q.done)
+	for msg := range q.events {
+		if m, ok := msg.(flushMarker); ok {
+			m.wg.Done()
+			continue
+		}
+		q.recorder(msg)
+	}
+}
+
+// FanOut passes events to recorders that each run on their own goroutine, with their own buffered
+// queue, so that a slow recorder, like a network push, doesn't delay the other recorders or back up
+// the event channel of the load test. Its Record method is a Recorder, which queues each event for
+// every recorder:
+//
+//	f := bender.NewFanOut(10000, bender.OverflowDrop, bender.NewHistogramRecorder(h), pushRecorder)
+//	bender.Record(recorder, f.Record)
+//	f.Close()
+//
+// The StartEvent, EndEvent, HistogramEvents and UserEndEvents are never dropped, since each of them
+// summarizes many requests, and the EndEvent is only returned from Record once
+// every recorder has handled every event before it, so the results are complete when Record
+// returns.
+type FanOut struct {
+	policy OverflowPolicy
+	queues []*recorderQueue
+}
+
+// NewFanOut creates a FanOut that queues up to size events for each of the recorders, and starts
+// their goroutines.
+func NewFanOut(size int, policy OverflowPolicy, recorders ...Recorder) *FanOut {
+	f := &FanOut{policy: policy}
+	for _, r := range recorders {
+		q := &recorderQueue{recorder: r, events: make(chan interface{}, size), done: make(chan struct{})}
+		f.queues = append(f.queues, q)
+		go q.run()
+	}
+	return f
+}
+
+// Record queues the event for each recorder, and waits for the recorders to handle all the queued
+// events after the EndEvent.
+func (f *FanOut) Record(msg interface{}) {
+	block := f.policy == OverflowBlock
+	switch msg.(type) {
+	case *StartEvent, *EndEvent, *HistogramEvent, *UserEndEvent:
+		block = true
+	}
+	for _, q := range f.queues {
+		if block {
+			q.events <- msg
+			continue
+		}
+		select {
+		case q.events <- msg:
+		default:
+			atomic.AddInt64(&q.dropped, 1)
+		}
+	}
+	if _, ok := msg.(*EndEvent); ok {
+		f.Flush()
+	}
+}
+
+// Flush waits until every recorder has handled the events queued before it.
+func (f *FanOut) Flush() {
+	var wg sync.WaitGroup
+	wg.Add(len(f.queues))
+	for _, q := range f.queues {
+		q.events <- flushMarker{&wg}
+	}
+	wg.Wait()
+}
+
+// Dropped returns the number of events dropped for each recorder, in the order the recorders were
+// passed to NewFanOut.
+func (f *FanOut) Dropped() []int {
+	dropped := make([]int, len(f.queues))
+	for i, q := range f.queues {
+		dropped[i] = int(atomic.LoadInt64(&q.dropped))
+	}
+	return dropped
+}
+
+// Close waits for the recorders to handle the queued events, and stops their goroutines. Record must
+// not be called after Close.
+func (f *FanOut) Close() {
+	for _, q := range f.queues {
+		close(q.events)
+	}
+	for _, q := range f.queues {
+		<-q.done
+	}
+}
+
+// RecordAsync records messages from a channel using the given recorders, like Record, but runs each
+// recorder on its own goroutine with a queue of the given size, using a FanOut. It returns the number
+// of events dropped for each recorder once the channel is closed and the recorders have handled all
+// the queued events.
+func RecordAsync(c chan interface{}, size int, policy OverflowPolicy, recorders ...Recorder) []int {
+	f := NewFanOut(size, policy, recorders...)
+	for msg := range c {
+		f.Record(msg)
+	}
+	f.Close()
+	return f.Dropped()
+}
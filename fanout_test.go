@@ -0,0 +1,121 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bender
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector is a recorder that saves the events it gets.
+type collector struct {
+	mu     sync.Mutex
+	events []interface{}
+}
+
+func (c *collector) record(msg interface{}) {
+	c.mu.Lock()
+	c.events = append(c.events, msg)
+	c.mu.Unlock()
+}
+
+func (c *collector) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.events)
+}
+
+func TestFanOutBlock(t *testing.T) {
+	c := make(chan interface{})
+	var a, b collector
+	go func() {
+		c <- &StartEvent{}
+		for i := 0; i < 100; i++ {
+			c <- &EndRequestEvent{Start: int64(i)}
+		}
+		c <- &EndEvent{}
+		close(c)
+	}()
+	dropped := RecordAsync(c, 2, OverflowBlock, a.record, b.record)
+
+	if !reflect.DeepEqual(dropped, []int{0, 0}) {
+		t.Errorf("Expected no dropped events, got %v", dropped)
+	}
+	if !reflect.DeepEqual(a.events, b.events) || len(a.events) != 102 {
+		t.Fatalf("Expected both recorders to get all 102 events, got %d and %d", len(a.events), len(b.events))
+	}
+	for i := 0; i < 100; i++ {
+		if e := a.events[i+1].(*EndRequestEvent); e.Start != int64(i) {
+			t.Errorf("Expected events in order, got %d at %d", e.Start, i)
+		}
+	}
+}
+
+func TestFanOutDrop(t *testing.T) {
+	release := make(chan struct{})
+	var fast, slow collector
+	f := NewFanOut(10, OverflowDrop, fast.record, func(msg interface{}) {
+		<-release
+		slow.record(msg)
+	})
+
+	f.Record(&StartEvent{})
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		f.Record(&EndRequestEvent{})
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Expected the slow recorder not to block Record, took %v", d)
+	}
+
+	close(release)
+	f.Record(&EndEvent{})
+	// After the EndEvent, every queued event has been recorded.
+	dropped := f.Dropped()
+	if dropped[1] < 80 || slow.count() != 102-dropped[1] || fast.count() != 102-dropped[0] {
+		t.Errorf("Unexpected dropped events %v with %d and %d events recorded", dropped, fast.count(), slow.count())
+	}
+	if _, ok := slow.events[len(slow.events)-1].(*EndEvent); !ok {
+		t.Errorf("Expected the EndEvent not to be dropped")
+	}
+	f.Close()
+}
+
+func TestFanOutDropAggregated(t *testing.T) {
+	cr := make(chan interface{})
+	LoadTestVirtualUsers(2, nil, nil, manyRequests(200), noOpExec, cr, WithAggregation(newTestHist, 0))
+
+	h := newTestHist()
+	record := NewHistogramRecorder(h)
+	users := 0
+	dropped := RecordAsync(cr, 1, OverflowDrop, func(msg interface{}) {
+		if _, ok := msg.(*UserEndEvent); ok {
+			users++
+		}
+		time.Sleep(100 * time.Microsecond)
+		record(msg)
+	})
+
+	if dropped[0] == 0 {
+		t.Errorf("Expected the slow recorder to drop events")
+	}
+	if h.Count() != 200 || users != 2 {
+		t.Errorf("Expected 200 aggregated requests and 2 users, got %d and %d", h.Count(), users)
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pinterest/bender"
+)
+
+// Thresholds are the limits beyond which the load generator likely skewed the latencies of a window.
+type Thresholds struct {
+	// The longest acceptable scheduling lag.
+	SchedLag time.Duration
+	// The longest acceptable garbage collection pause, as a fraction of the p99 latency of the
+	// window.
+	GCPauseOfP99 float64
+	// The highest acceptable CPU usage, as a fraction of GOMAXPROCS.
+	CPU float64
+}
+
+// DefaultThresholds are the thresholds used if none are given.
+var DefaultThresholds = Thresholds{SchedLag: 5 * time.Millisecond, GCPauseOfP99: 0.1, CPU: 0.8}
+
+// Warning describes a problem of the load generator that likely skewed the latencies of some of the
+// windows of a load test.
+type Warning struct {
+	// The problem, which is "sched_lag", "gc_pause" or "cpu".
+	Metric string `json:"metric"`
+	// The number of windows with the problem, and the start time of the first of them.
+	Windows int   `json:"windows"`
+	First   int64 `json:"first"`
+	// A description of the problem.
+	Message string `json:"message"`
+}
+
+func (w Warning) String() string {
+	return w.Message
+}
+
+// windowHealth is the worst health of the load generator during a window.
+type windowHealth struct {
+	schedLag, gcPause time.Duration
+	cpu               float64
+}
+
+// Check correlates the samples of a Monitor with the windows of a load test, and returns a warning
+// for each kind of problem found in any of the windows: a scheduling lag above the threshold, a
+// garbage collection pause that is a large part of the window's p99 latency, or a CPU usage high
+// enough that the load generator was likely CPU bound. If th is nil, DefaultThresholds are used.
+func Check(samples []Sample, ws *bender.WindowedStats, th *Thresholds) []Warning {
+	if th == nil {
+		th = &DefaultThresholds
+	}
+	var lag, gc, cpu Warning
+	lag.Metric, gc.Metric, cpu.Metric = "sched_lag", "gc_pause", "cpu"
+	var maxLag, maxPause time.Duration
+	var maxCPU float64
+	flag := func(w *Warning, win *bender.Window) {
+		if w.Windows == 0 {
+			w.First = win.Start
+		}
+		w.Windows++
+	}
+
+	for _, win := range ws.Windows {
+		var h windowHealth
+		for _, s := range samples {
+			if s.Start >= win.End || s.End <= win.Start {
+				continue
+			}
+			if s.SchedLag > h.schedLag {
+				h.schedLag = s.SchedLag
+			}
+			if s.GCPauseMax > h.gcPause {
+				h.gcPause = s.GCPauseMax
+			}
+			if s.CPU > h.cpu {
+				h.cpu = s.CPU
+			}
+		}
+
+		if h.schedLag > th.SchedLag {
+			flag(&lag, win)
+			if h.schedLag > maxLag {
+				maxLag = h.schedLag
+			}
+		}
+		if h.gcPause > 0 && win.Hist.Count() > 0 {
+			p99 := win.Hist.InterpolatedPercentiles(0.99)[0] * float64(win.Hist.Scale())
+			if float64(h.gcPause) >= th.GCPauseOfP99*p99 {
+				flag(&gc, win)
+				if h.gcPause > maxPause {
+					maxPause = h.gcPause
+				}
+			}
+		}
+		if h.cpu >= th.CPU {
+			flag(&cpu, win)
+			if h.cpu > maxCPU {
+				maxCPU = h.cpu
+			}
+		}
+	}
+
+	var warnings []Warning
+	where := func(w *Warning) string {
+		return fmt.Sprintf("in %d of %d windows, first at %s", w.Windows, len(ws.Windows),
+			time.Duration(w.First-ws.Start).Round(time.Millisecond))
+	}
+	if lag.Windows > 0 {
+		lag.Message = fmt.Sprintf("scheduling lag up to %s %s: goroutines timing requests waited to run, so latencies may be overstated",
+			maxLag.Round(time.Microsecond), where(&lag))
+		warnings = append(warnings, lag)
+	}
+	if gc.Windows > 0 {
+		gc.Message = fmt.Sprintf("GC pauses up to %s, at least %.0f%% of the p99 latency, %s: the tail latencies may include load generator GC",
+			maxPause.Round(time.Microsecond), th.GCPauseOfP99*100, where(&gc))
+		warnings = append(warnings, gc)
+	}
+	if cpu.Windows > 0 {
+		cpu.Message = fmt.Sprintf("CPU usage up to %.0f%% of GOMAXPROCS %s: the load generator was likely CPU bound",
+			maxCPU*100, where(&cpu))
+		warnings = append(warnings, cpu)
+	}
+	return warnings
+}
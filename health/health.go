@@ -0,0 +1,207 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package health monitors the load generator itself while a load test runs, by sampling the Go
+// runtime (garbage collection pauses, heap size and goroutines), the CPU used by the process and
+// the scheduling lag of a probe goroutine. The overage of the WaitEvents only shows that the load
+// tester fell behind its schedule, while these samples show why, and the windows of a load test in
+// which they may have skewed the latencies, since a request that waits for the garbage collector or
+// a busy CPU looks slow even when the service was fast.
+package health
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/pinterest/bender"
+)
+
+// probeInterval is how long the probe goroutine sleeps between measurements of the scheduling lag.
+const probeInterval = time.Millisecond
+
+// Sample holds the health of the load generator over an interval of a load test.
+type Sample struct {
+	// The Unix epoch times (in nanoseconds) of the start and end of the interval.
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	// The size of the heap and the number of goroutines at the end of the interval.
+	HeapAlloc  uint64 `json:"heap_alloc"`
+	Goroutines int    `json:"goroutines"`
+	// The number of garbage collections in the interval, and the total and longest of their
+	// stop-the-world pauses.
+	GCs          int           `json:"gcs"`
+	GCPauseTotal time.Duration `json:"gc_pause_total"`
+	GCPauseMax   time.Duration `json:"gc_pause_max"`
+	// The CPU used by the process, as a fraction of GOMAXPROCS, or -1 if it isn't known on this
+	// platform.
+	CPU float64 `json:"cpu"`
+	// The longest time the probe goroutine was woken up late, which is how long any goroutine, like
+	// one timing a request, may have waited to run.
+	SchedLag time.Duration `json:"sched_lag"`
+}
+
+// Monitor samples the health of the load generator during a load test. Its Record method is a
+// Recorder, which starts the sampling at the StartEvent and stops it at the EndEvent:
+//
+//	m := health.NewMonitor(time.Second)
+//	bender.Record(recorder, bender.NewWindowedRecorder(ws), m.Record)
+//	for _, w := range health.Check(m.Samples(), ws, nil) {
+//		fmt.Println(w)
+//	}
+type Monitor struct {
+	interval time.Duration
+
+	mu       sync.Mutex
+	samples  []Sample
+	schedLag time.Duration
+
+	// The state at the start of the current interval.
+	last      int64
+	lastGCs   uint32
+	lastPause uint64
+	lastCPU   time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewMonitor creates a Monitor that takes a sample every interval. It panics if the interval isn't
+// positive.
+func NewMonitor(interval time.Duration) *Monitor {
+	if interval <= 0 {
+		panic(fmt.Sprintf("health: invalid sampling interval %v", interval))
+	}
+	return &Monitor{interval: interval}
+}
+
+// Record starts the sampling at the StartEvent, and stops it at the EndEvent, after a last sample.
+func (m *Monitor) Record(msg interface{}) {
+	switch msg.(type) {
+	case *bender.StartEvent:
+		m.start()
+	case *bender.EndEvent:
+		m.Stop()
+	}
+}
+
+func (m *Monitor) start() {
+	m.Stop()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	cpu, _ := cpuTime()
+
+	m.mu.Lock()
+	m.samples, m.schedLag = nil, 0
+	m.last, m.lastGCs, m.lastPause, m.lastCPU = time.Now().UnixNano(), ms.NumGC, ms.PauseTotalNs, cpu
+	m.stop, m.done = make(chan struct{}), make(chan struct{})
+	m.mu.Unlock()
+
+	go m.probe(m.stop)
+	go m.run(m.stop, m.done)
+}
+
+// Stop stops the sampling, after a last sample. It does nothing if the sampling isn't running.
+func (m *Monitor) Stop() {
+	m.mu.Lock()
+	stop, done := m.stop, m.done
+	m.stop, m.done = nil, nil
+	m.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+	m.sample()
+}
+
+func (m *Monitor) run(stop, done chan struct{}) {
+	defer close(done)
+	t := time.NewTicker(m.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			m.sample()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// probe measures how late the scheduler wakes up a sleeping goroutine, until stop is closed.
+func (m *Monitor) probe(stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		start := time.Now()
+		time.Sleep(probeInterval)
+		lag := time.Since(start) - probeInterval
+		m.mu.Lock()
+		if lag > m.schedLag {
+			m.schedLag = lag
+		}
+		m.mu.Unlock()
+	}
+}
+
+// sample adds a sample for the interval since the last one.
+func (m *Monitor) sample() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	cpu, cpuOK := cpuTime()
+	now := time.Now().UnixNano()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := Sample{
+		Start:        m.last,
+		End:          now,
+		HeapAlloc:    ms.HeapAlloc,
+		Goroutines:   runtime.NumGoroutine(),
+		GCs:          int(ms.NumGC - m.lastGCs),
+		GCPauseTotal: time.Duration(ms.PauseTotalNs - m.lastPause),
+		CPU:          -1,
+		SchedLag:     m.schedLag,
+	}
+	// The last 256 pauses are kept in a circular buffer, where the pause of the nth collection is
+	// at index (n-1)%256.
+	first := m.lastGCs + 1
+	if ms.NumGC > 256 && first < ms.NumGC-255 {
+		first = ms.NumGC - 255
+	}
+	for n := first; n <= ms.NumGC; n++ {
+		if p := time.Duration(ms.PauseNs[(n-1)%256]); p > s.GCPauseMax {
+			s.GCPauseMax = p
+		}
+	}
+	if cpuOK && now > m.last {
+		s.CPU = float64(cpu-m.lastCPU) / float64(now-m.last) / float64(runtime.GOMAXPROCS(0))
+	}
+	m.samples = append(m.samples, s)
+	m.last, m.lastGCs, m.lastPause, m.lastCPU, m.schedLag = now, ms.NumGC, ms.PauseTotalNs, cpu, 0
+}
+
+// Samples returns the samples taken so far.
+func (m *Monitor) Samples() []Sample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Sample(nil), m.samples...)
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pinterest/bender"
+	"github.com/pinterest/bender/hist"
+)
+
+func TestMonitor(t *testing.T) {
+	m := NewMonitor(10 * time.Millisecond)
+	m.Record(&bender.StartEvent{Start: time.Now().UnixNano()})
+	time.Sleep(25 * time.Millisecond)
+	runtime.GC()
+	m.Record(&bender.EndEvent{})
+
+	samples := m.Samples()
+	if len(samples) < 2 {
+		t.Fatalf("Expected at least 2 samples, got %d", len(samples))
+	}
+	gcs := 0
+	for i, s := range samples {
+		if s.End <= s.Start || (i > 0 && s.Start != samples[i-1].End) {
+			t.Errorf("Expected contiguous intervals, got sample %d %+v", i, s)
+		}
+		if s.HeapAlloc == 0 || s.Goroutines == 0 || s.CPU < 0 && runtime.GOOS == "linux" {
+			t.Errorf("Unexpected sample %d %+v", i, s)
+		}
+		gcs += s.GCs
+	}
+	if gcs == 0 || samples[len(samples)-1].GCPauseMax == 0 {
+		t.Errorf("Expected the last sample to have the forced GC, got %+v", samples[len(samples)-1])
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if n := len(m.Samples()); n != len(samples) {
+		t.Errorf("Expected no samples after the EndEvent, got %d more", n-len(samples))
+	}
+}
+
+func TestMonitorInterval(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic creating a monitor with a zero interval")
+		}
+	}()
+	NewMonitor(0)
+}
+
+func TestCheck(t *testing.T) {
+	sec, ms := int64(time.Second), int64(time.Millisecond)
+	ws := bender.NewWindowedStats(time.Second, func() *hist.Histogram {
+		return hist.NewLogHistogram(2, int(time.Microsecond))
+	})
+	r := bender.NewWindowedRecorder(ws)
+	r(&bender.StartEvent{Start: 0})
+	for i := int64(0); i < 40; i++ {
+		start := i * sec / 10
+		r(&bender.EndRequestEvent{Start: start, End: start + 10*ms})
+	}
+	r(&bender.EndEvent{Start: 0, End: 4*sec - ms})
+
+	samples := []Sample{
+		{Start: 0, End: sec, CPU: 0.2, SchedLag: time.Millisecond},
+		{Start: sec, End: 2 * sec, CPU: 0.3, SchedLag: 20 * time.Millisecond},
+		{Start: 2 * sec, End: 3 * sec, CPU: 0.95, GCPauseMax: 2 * time.Millisecond},
+		{Start: 3 * sec, End: 4 * sec, CPU: 0.9, GCPauseMax: 100 * time.Microsecond},
+	}
+	warnings := Check(samples, ws, nil)
+	if len(warnings) != 3 {
+		t.Fatalf("Expected 3 warnings, got %v", warnings)
+	}
+	for i, want := range []struct {
+		metric  string
+		windows int
+		first   int64
+		message string
+	}{
+		{"sched_lag", 1, sec, "scheduling lag up to 20ms in 1 of 4 windows, first at 1s"},
+		{"gc_pause", 1, 2 * sec, "GC pauses up to 2ms, at least 10% of the p99 latency, in 1 of 4 windows, first at 2s"},
+		{"cpu", 2, 2 * sec, "CPU usage up to 95% of GOMAXPROCS in 2 of 4 windows, first at 2s"},
+	} {
+		w := warnings[i]
+		if w.Metric != want.metric || w.Windows != want.windows || w.First != want.first || !strings.HasPrefix(w.Message, want.message) {
+			t.Errorf("Unexpected warning %+v, want %+v", w, want)
+		}
+	}
+
+	if warnings := Check(samples[:1], ws, nil); len(warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", warnings)
+	}
+}
@@ -0,0 +1,404 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// encodingVersion is the version of the binary and JSON encodings of a Histogram.
+const encodingVersion = 1
+
+// maxBuckets is the largest bucket max of a decoded linear Histogram, which bounds the memory a
+// corrupted or hostile encoding can make the decoder allocate.
+const maxBuckets = 1 << 24
+
+// binaryMagic starts every binary-encoded Histogram.
+var binaryMagic = []byte("BHST")
+
+// histogramJSON is the JSON encoding of a Histogram. Buckets holds [index, count] pairs for the
+// non-empty buckets only.
+type histogramJSON struct {
+	Version      int                         `json:"version"`
+	Scale        int                         `json:"scale"`
+	BucketMax    int                         `json:"max"`
+	Digits       int                         `json:"digits"`
+	Start        int                         `json:"start"`
+	End          int                         `json:"end"`
+	Count        int                         `json:"count"`
+	Errors       int                         `json:"errors"`
+	Min          int                         `json:"min"`
+	Max          int                         `json:"max_value"`
+	Sum          float64                     `json:"sum"`
+	SumSq        float64                     `json:"sum_sq"`
+	Overflow     int                         `json:"overflow"`
+	OKMin        int                         `json:"ok_min"`
+	OKMax        int                         `json:"ok_max"`
+	Buckets      [][2]int                    `json:"buckets"`
+	ErrorClasses map[string]*ErrorClassStats `json:"error_classes,omitempty"`
+	Errs         *Histogram                  `json:"error_histogram,omitempty"`
+}
+
+// checkBucketing checks the bucketing of an encoded histogram with the given number of encoded
+// buckets, before any memory is allocated for it.
+func checkBucketing(max, scale, digits, buckets int) error {
+	if scale <= 0 || max < 0 || max > maxBuckets || digits < 0 || digits > 5 || buckets < 0 {
+		return errors.New("invalid histogram bucketing")
+	}
+	if digits == 0 && buckets > max+1 {
+		return fmt.Errorf("invalid histogram bucket count %d", buckets)
+	}
+	return nil
+}
+
+// checkCounts checks that the counts of a decoded histogram agree with each other.
+func (h *Histogram) checkCounts() error {
+	total := 0
+	for _, c := range h.values {
+		total += c
+	}
+	if total != h.n || h.errCnt < 0 || h.errCnt > h.n || h.overflow < 0 || h.overflow > h.n ||
+		(h.errs != nil && h.errs.n != h.errCnt) {
+		return errors.New("inconsistent histogram counts")
+	}
+	// Every error is also counted in the combined distribution, in the same bucket.
+	if h.errs != nil {
+		if len(h.errs.values) > len(h.values) {
+			return errors.New("inconsistent histogram error distribution")
+		}
+		for i, c := range h.errs.values {
+			if c > h.values[i] {
+				return errors.New("inconsistent histogram error distribution")
+			}
+		}
+	}
+	return nil
+}
+
+// newEmpty creates an empty histogram with the given bucketing.
+func newEmpty(max, scale, digits int) *Histogram {
+	if digits == 0 {
+		return NewHistogram(max, scale)
+	}
+	return NewLogHistogram(digits, scale)
+}
+
+// MarshalJSON encodes the full state of the histogram as JSON, so it can be saved and later decoded
+// with UnmarshalJSON, for example to merge the histograms of several load testing hosts.
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	hj := histogramJSON{
+		Version:      encodingVersion,
+		Scale:        h.scale,
+		BucketMax:    h.max,
+		Digits:       h.digits,
+		Start:        h.start,
+		End:          h.end,
+		Count:        h.n,
+		Errors:       h.errCnt,
+		Min:          h.minValue,
+		Max:          h.maxValue,
+		Sum:          h.sum,
+		SumSq:        h.sumSq,
+		Overflow:     h.overflow,
+		OKMin:        h.okMin,
+		OKMax:        h.okMax,
+		Buckets:      [][2]int{},
+		ErrorClasses: h.errClasses,
+		Errs:         h.errs,
+	}
+	for i, c := range h.values {
+		if c != 0 {
+			hj.Buckets = append(hj.Buckets, [2]int{i, c})
+		}
+	}
+	return json.Marshal(hj)
+}
+
+// UnmarshalJSON decodes a histogram encoded by MarshalJSON, replacing the state of h.
+func (h *Histogram) UnmarshalJSON(data []byte) error {
+	var hj histogramJSON
+	if err := json.Unmarshal(data, &hj); err != nil {
+		return err
+	}
+	if hj.Version != encodingVersion {
+		return fmt.Errorf("unsupported histogram version %d", hj.Version)
+	}
+	if err := checkBucketing(hj.BucketMax, hj.Scale, hj.Digits, len(hj.Buckets)); err != nil {
+		return err
+	}
+
+	d := newEmpty(hj.BucketMax, hj.Scale, hj.Digits)
+	d.start, d.end, d.n, d.errCnt = hj.Start, hj.End, hj.Count, hj.Errors
+	d.minValue, d.maxValue, d.sum, d.sumSq, d.overflow = hj.Min, hj.Max, hj.Sum, hj.SumSq, hj.Overflow
+	d.okMin, d.okMax = hj.OKMin, hj.OKMax
+	if err := d.setErrs(hj.Errs); err != nil {
+		return err
+	}
+	for _, b := range hj.Buckets {
+		if err := d.setBucket(b[0], b[1]); err != nil {
+			return err
+		}
+	}
+	for class, stats := range hj.ErrorClasses {
+		if stats != nil {
+			d.errClasses[class] = stats
+		}
+	}
+	if err := d.checkCounts(); err != nil {
+		return err
+	}
+	*h = *d
+	return nil
+}
+
+// setErrs sets the error distribution of the histogram, checking that it has the same bucketing.
+func (h *Histogram) setErrs(errs *Histogram) error {
+	if errs != nil && (errs.scale != h.scale || errs.max != h.max || errs.digits != h.digits) {
+		return errors.New("invalid histogram error distribution")
+	}
+	h.errs = errs
+	return nil
+}
+
+// setBucket sets the count of the bucket with the given index, checking that it is valid.
+func (h *Histogram) setBucket(i, c int) error {
+	if i < 0 || c < 0 || (h.digits == 0 && i > h.max) || (h.digits != 0 && i > h.index(int(^uint(0)>>1))) {
+		return fmt.Errorf("invalid histogram bucket %d", i)
+	}
+	if i >= len(h.values) {
+		h.values = append(h.values, make([]int, i+1-len(h.values))...)
+	}
+	h.values[i] = c
+	return nil
+}
+
+// MarshalBinary encodes the full state of the histogram in a compact binary format, which can be
+// decoded with UnmarshalBinary.
+func (h *Histogram) MarshalBinary() ([]byte, error) {
+	var e encoder
+	e.buf = append(e.buf, binaryMagic...)
+	e.uvarint(encodingVersion)
+	for _, v := range []int{h.scale, h.max, h.digits, h.start, h.end, h.n, h.errCnt, h.minValue, h.maxValue, h.overflow, h.okMin, h.okMax} {
+		e.varint(v)
+	}
+	e.float(h.sum)
+	e.float(h.sumSq)
+
+	nonEmpty := 0
+	for _, c := range h.values {
+		if c != 0 {
+			nonEmpty++
+		}
+	}
+	e.uvarint(nonEmpty)
+	last := 0
+	for i, c := range h.values {
+		if c != 0 {
+			// Bucket indexes are delta encoded, since they are sorted.
+			e.uvarint(i - last)
+			e.varint(c)
+			last = i
+		}
+	}
+
+	classes := make([]string, 0, len(h.errClasses))
+	for class := range h.errClasses {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	e.uvarint(len(classes))
+	for _, class := range classes {
+		stats := h.errClasses[class]
+		e.string(class)
+		e.varint(stats.Count)
+		e.uvarint(len(stats.Examples))
+		for _, ex := range stats.Examples {
+			e.string(ex)
+		}
+	}
+
+	if h.errs == nil {
+		e.uvarint(0)
+	} else {
+		errs, err := h.errs.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		e.uvarint(1)
+		e.string(string(errs))
+	}
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes a histogram encoded by MarshalBinary, replacing the state of h.
+func (h *Histogram) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, binaryMagic) {
+		return errors.New("not a binary histogram")
+	}
+	d := decoder{r: bytes.NewReader(data[len(binaryMagic):])}
+	if v := d.uvarint(); d.err == nil && v != encodingVersion {
+		return fmt.Errorf("unsupported histogram version %d", v)
+	}
+	fields := make([]int, 12)
+	for i := range fields {
+		fields[i] = d.varint()
+	}
+	sum, sumSq := d.float(), d.float()
+	if d.err != nil {
+		return d.err
+	}
+	// Every encoded bucket takes at least two bytes.
+	buckets := d.uvarint()
+	if d.err == nil && buckets > d.r.Len()/2 {
+		d.err = fmt.Errorf("invalid histogram bucket count %d", buckets)
+	}
+	if d.err != nil {
+		return d.err
+	}
+	scale, max, digits := fields[0], fields[1], fields[2]
+	if err := checkBucketing(max, scale, digits, buckets); err != nil {
+		return err
+	}
+
+	hd := newEmpty(max, scale, digits)
+	hd.start, hd.end, hd.n, hd.errCnt = fields[3], fields[4], fields[5], fields[6]
+	hd.minValue, hd.maxValue, hd.overflow = fields[7], fields[8], fields[9]
+	hd.okMin, hd.okMax = fields[10], fields[11]
+	hd.sum, hd.sumSq = sum, sumSq
+	i := 0
+	for n := buckets; n > 0 && d.err == nil; n-- {
+		i += d.uvarint()
+		if c := d.varint(); d.err == nil {
+			if err := hd.setBucket(i, c); err != nil {
+				return err
+			}
+		}
+	}
+	for n := d.uvarint(); n > 0 && d.err == nil; n-- {
+		class := d.string()
+		stats := &ErrorClassStats{Count: d.varint()}
+		for m := d.uvarint(); m > 0 && d.err == nil; m-- {
+			stats.Examples = append(stats.Examples, d.string())
+		}
+		hd.errClasses[class] = stats
+	}
+	if d.uvarint() == 1 {
+		var errs Histogram
+		if data := d.string(); d.err == nil {
+			if err := errs.UnmarshalBinary([]byte(data)); err != nil {
+				return err
+			}
+			if err := hd.setErrs(&errs); err != nil {
+				return err
+			}
+		}
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if err := hd.checkCounts(); err != nil {
+		return err
+	}
+	*h = *hd
+	return nil
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uvarint(v int) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutUvarint(b[:], uint64(v))]...)
+}
+
+func (e *encoder) varint(v int) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutVarint(b[:], int64(v))]...)
+}
+
+func (e *encoder) float(f float64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(f))
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(len(s))
+	e.buf = append(e.buf, s...)
+}
+
+// decoder reads the values written by an encoder, and keeps the first error it encounters, after
+// which it returns zero values.
+type decoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *decoder) uvarint() int {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	if err == nil && v > 1<<62 {
+		err = errors.New("histogram value out of range")
+	}
+	d.err = err
+	return int(v)
+}
+
+func (d *decoder) varint() int {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(d.r)
+	d.err = err
+	return int(v)
+}
+
+func (d *decoder) float() float64 {
+	if d.err != nil {
+		return 0
+	}
+	var b [8]byte
+	if _, err := io.ReadFull(d.r, b[:]); err != nil {
+		d.err = err
+		return 0
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b[:]))
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if n > d.r.Len() {
+		d.err = errors.New("histogram string out of range")
+		return ""
+	}
+	b := make([]byte, n)
+	_, d.err = d.r.Read(b)
+	return string(b)
+}
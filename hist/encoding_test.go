@@ -0,0 +1,152 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hist
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func testHistogram(h *Histogram) *Histogram {
+	h.Start(1000)
+	for i := 1; i <= 100; i++ {
+		h.Add(i)
+	}
+	h.AddErrorClass(7, "timeout", "i/o timeout")
+	h.End(2000)
+	return h
+}
+
+func TestMerge(t *testing.T) {
+	h1 := NewHistogram(100, 1)
+	h2 := NewHistogram(100, 1)
+	h1.Start(20)
+	h2.Start(10)
+	for i := 1; i <= 50; i++ {
+		h1.Add(i)
+		h2.Add(i + 50)
+	}
+	h2.AddErrorClass(100, "timeout", "i/o timeout")
+	h1.End(100)
+	h2.End(200)
+
+	if err := h1.Merge(h2); err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	ps := h1.Percentiles(0.0, 0.5, 0.99, 1.0)
+	expected := []int{1, 50, 99, 100}
+	for i, p := range ps {
+		if p != expected[i] {
+			t.Errorf("Actual(%d) != Expected(%d)", p, expected[i])
+		}
+	}
+	if h1.n != 101 || h1.errCnt != 1 || h1.ErrorClasses()["timeout"].Count != 1 {
+		t.Errorf("Expected 101 values with 1 timeout, got %d with %d errors", h1.n, h1.errCnt)
+	}
+	if h1.start != 10 || h1.end != 200 {
+		t.Errorf("Expected merged time range [10, 200], got [%d, %d]", h1.start, h1.end)
+	}
+
+	if err := h1.Merge(NewLogHistogram(3, 1)); err == nil {
+		t.Error("Expected an error merging histograms with different bucketing")
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	for _, h := range []*Histogram{testHistogram(NewHistogram(50, 1)), testHistogram(NewLogHistogram(2, 1))} {
+		data, err := json.Marshal(h)
+		if err != nil {
+			t.Fatalf("Expected no error, got (%v)", err)
+		}
+		var d Histogram
+		if err := json.Unmarshal(data, &d); err != nil {
+			t.Fatalf("Expected no error, got (%v)", err)
+		}
+		if !reflect.DeepEqual(h, &d) {
+			t.Errorf("Decoded histogram %+v != Encoded %+v", &d, h)
+		}
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	for _, h := range []*Histogram{testHistogram(NewHistogram(50, 1)), testHistogram(NewLogHistogram(2, 1))} {
+		data, err := h.MarshalBinary()
+		if err != nil {
+			t.Fatalf("Expected no error, got (%v)", err)
+		}
+		var d Histogram
+		if err := d.UnmarshalBinary(data); err != nil {
+			t.Fatalf("Expected no error, got (%v)", err)
+		}
+		if !reflect.DeepEqual(h, &d) {
+			t.Errorf("Decoded histogram %+v != Encoded %+v", &d, h)
+		}
+		if err := d.UnmarshalBinary(data[:len(data)-3]); err == nil {
+			t.Error("Expected an error decoding a truncated histogram")
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	var e encoder
+	e.buf = append(e.buf, binaryMagic...)
+	e.uvarint(encodingVersion)
+	// A linear histogram with a huge max and a single bucket.
+	for _, v := range []int{1, 1 << 40, 0, 0, 0, 1, 0, 1, 1, 0, 1, 1} {
+		e.varint(v)
+	}
+	e.float(1)
+	e.float(1)
+	e.uvarint(1)
+	e.uvarint(1)
+	e.varint(1)
+	var d Histogram
+	if err := d.UnmarshalBinary(e.buf); err == nil {
+		t.Error("Expected an error decoding a histogram with a huge max")
+	}
+
+	h := testHistogram(NewHistogram(50, 1))
+	h.n++
+	data, _ := h.MarshalBinary()
+	if err := d.UnmarshalBinary(data); err == nil {
+		t.Error("Expected an error decoding a binary histogram with inconsistent counts")
+	}
+	data, _ = json.Marshal(h)
+	if err := json.Unmarshal(data, &d); err == nil {
+		t.Error("Expected an error decoding a JSON histogram with inconsistent counts")
+	}
+	if err := json.Unmarshal([]byte(`{"version":1,"scale":1,"max":1099511627776}`), &d); err == nil {
+		t.Error("Expected an error decoding a JSON histogram with a huge max")
+	}
+
+	// An error distribution with a value outside of the combined distribution.
+	h = NewLogHistogram(2, 1)
+	h.Add(1)
+	h.AddError(2)
+	h.errs = NewLogHistogram(2, 1)
+	h.errs.add(100000)
+	h.errs.errCnt++
+	data, _ = h.MarshalBinary()
+	if err := d.UnmarshalBinary(data); err == nil {
+		t.Error("Expected an error decoding a binary histogram with an inconsistent error distribution")
+	}
+	data, _ = json.Marshal(h)
+	if err := json.Unmarshal(data, &d); err == nil {
+		t.Error("Expected an error decoding a JSON histogram with an inconsistent error distribution")
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hist
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// Exemplar describes one request of a load test, like one of the slowest requests, so that the
+// values in the tail of a histogram can be traced back to actual requests.
+type Exemplar struct {
+	// The Unix epoch times (in nanoseconds) at which the request started and finished.
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	// The latency of the request.
+	Latency time.Duration `json:"latency"`
+	// The host that served the request, if it is known.
+	Target string `json:"target,omitempty"`
+	// Summaries of the request and response.
+	Request  string `json:"request,omitempty"`
+	Response string `json:"response,omitempty"`
+	// The class and message of the error, if the request failed.
+	ErrorClass string `json:"error_class,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Exemplars holds the slowest requests of a load test, and a sample of its failed requests.
+type Exemplars struct {
+	// The slowest requests, slowest first.
+	Slowest []Exemplar `json:"slowest,omitempty"`
+	// A uniform random sample of the failed requests, in the order they finished.
+	Errors []Exemplar `json:"errors,omitempty"`
+}
+
+// WriteText writes the exemplars to w as two tables, of the slowest requests and of the sampled
+// failed requests.
+func (e *Exemplars) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	tables := []struct {
+		title     string
+		exemplars []Exemplar
+	}{{"Slowest requests", e.Slowest}, {"Failed requests", e.Errors}}
+	for i, t := range tables {
+		if len(t.exemplars) == 0 {
+			continue
+		}
+		if i > 0 && len(e.Slowest) > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintln(tw, t.title+":")
+		fmt.Fprintln(tw, "start\tlatency\ttarget\trequest\tresponse\terror")
+		for _, x := range t.exemplars {
+			errMsg := x.Error
+			if x.ErrorClass != "" {
+				errMsg = x.ErrorClass + ": " + errMsg
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", time.Unix(0, x.Start).UTC().Format(time.RFC3339Nano),
+				x.Latency, dash(x.Target), dash(x.Request), dash(x.Response), dash(errMsg))
+		}
+	}
+	return tw.Flush()
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
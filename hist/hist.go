@@ -19,25 +19,114 @@ package hist
 import (
 	"fmt"
 	"math"
+	"math/bits"
 	"sort"
+	"strings"
 	"time"
 )
 
+// maxErrorExamples is the number of example error messages kept for each error class.
+const maxErrorExamples = 3
+
+// ErrorClassStats holds the number of errors in an error class, and a few example messages.
+type ErrorClassStats struct {
+	Count    int      `json:"count"`
+	Examples []string `json:"examples"`
+}
+
 // Histogram defines a histogram.
 type Histogram struct {
-	start  int
-	end    int
-	scale  int
-	max    int
-	n      int
-	errCnt int
-	total  int
-	values []int
+	start   int
+	end     int
+	scale   int
+	max     int
+	digits  int
+	subBits uint
+	n       int
+	errCnt  int
+	// The exact (unscaled) minimum, maximum, sum and sum of squares of the values, and the number
+	// of values that were larger than max.
+	minValue   int
+	maxValue   int
+	sum        float64
+	sumSq      float64
+	overflow   int
+	values     []int
+	errClasses map[string]*ErrorClassStats
+	// The distribution of the error values only, created when the first error is added, and the
+	// exact minimum and maximum of the successful values, so that successes and errors can be
+	// reported separately.
+	errs         *Histogram
+	okMin, okMax int
 }
 
-// NewHistogram creates a new Histogram.
+func newHistogram(max, scale, digits int, subBits uint, buckets int) *Histogram {
+	return &Histogram{
+		scale:      scale,
+		max:        max,
+		digits:     digits,
+		subBits:    subBits,
+		values:     make([]int, buckets),
+		errClasses: make(map[string]*ErrorClassStats),
+	}
+}
+
+// NewHistogram creates a new Histogram with one bucket for each multiple of scale from zero to max,
+// inclusive. Values larger than max are counted in the max bucket.
 func NewHistogram(max int, scale int) *Histogram {
-	return &Histogram{0, 0, scale, max, 0, 0, 0, make([]int, max+1)}
+	return newHistogram(max, scale, 0, 0, max+1)
+}
+
+// NewLogHistogram creates a new log-linear (HDR-style) Histogram, whose buckets keep the given number
+// of significant decimal digits of each value (a multiple of scale) so that the relative error of
+// the reported values is constant across any range of values. The histogram has no maximum value,
+// and its memory grows with the logarithm of the largest value added, so it can cover microseconds
+// to minutes in a few thousand buckets with three digits. The digits must be between 1 and 5, and
+// are clamped to that range.
+func NewLogHistogram(digits int, scale int) *Histogram {
+	if digits < 1 {
+		digits = 1
+	} else if digits > 5 {
+		digits = 5
+	}
+	// Use enough linear sub-buckets per power of two to resolve values to the requested digits.
+	subBits := uint(math.Ceil(math.Log2(2 * math.Pow10(digits))))
+	return newHistogram(0, scale, digits, subBits, 1<<subBits)
+}
+
+// index returns the index of the bucket for the scaled value v.
+func (h *Histogram) index(v int) int {
+	if h.digits == 0 {
+		if v < 1 {
+			return 0
+		} else if v >= h.max {
+			return h.max
+		}
+		return v
+	}
+
+	subCount := 1 << h.subBits
+	if v < subCount {
+		if v < 0 {
+			return 0
+		}
+		return v
+	}
+	// Values in [2^(subBits+e-1), 2^(subBits+e)) have buckets of width 2^e.
+	e := uint(bits.Len(uint(v))) - h.subBits
+	return subCount + int(e-1)<<(h.subBits-1) + (v >> e) - subCount/2
+}
+
+// value returns the highest scaled value counted in the bucket with the given index.
+func (h *Histogram) value(i int) int {
+	subCount := 1 << h.subBits
+	if h.digits == 0 || i < subCount {
+		return i
+	}
+	half := subCount / 2
+	e := uint((i-subCount)/half + 1)
+	low := ((i-subCount)%half + half) << e
+	return low + 1<<e - 1
 }
 
 // Start starts the histogram with the given value.
@@ -52,54 +141,337 @@ func (h *Histogram) End(t int) {
 
 // Add adds a new value to the histogram.
 func (h *Histogram) Add(v int) {
-	v = int(float64(v) / float64(h.scale))
-	if v < 1 {
-		h.values[0]++
-	} else if v >= h.max {
-		h.values[h.max]++
-	} else {
-		h.values[v]++
+	if ok := h.n - h.errCnt; ok == 0 || v < h.okMin {
+		h.okMin = v
+	}
+	if ok := h.n - h.errCnt; ok == 0 || v > h.okMax {
+		h.okMax = v
+	}
+	h.add(v)
+}
+
+// add adds a new value to the histogram's combined distribution.
+func (h *Histogram) add(v int) {
+	if h.n == 0 || v < h.minValue {
+		h.minValue = v
+	}
+	if h.n == 0 || v > h.maxValue {
+		h.maxValue = v
 	}
 	h.n++
-	h.total += v
+	h.sum += float64(v)
+	h.sumSq += float64(v) * float64(v)
+
+	scaled := int(float64(v) / float64(h.scale))
+	if h.digits == 0 && scaled > h.max {
+		h.overflow++
+	}
+	i := h.index(scaled)
+	if i >= len(h.values) {
+		h.values = append(h.values, make([]int, i+1-len(h.values))...)
+	}
+	h.values[i]++
 }
 
 // AddError adds a new error value to the histogram.
 func (h *Histogram) AddError(v int) {
-	h.Add(v)
+	h.add(v)
 	h.errCnt++
+	if h.errs == nil {
+		h.errs = newEmpty(h.max, h.scale, h.digits)
+	}
+	h.errs.add(v)
+	h.errs.errCnt++
+}
+
+// Successes returns a new histogram with only the successful values in this histogram.
+func (h *Histogram) Successes() *Histogram {
+	s := h.clone()
+	s.errs = nil
+	s.errCnt = 0
+	s.errClasses = make(map[string]*ErrorClassStats)
+	if h.errs == nil {
+		return s
+	}
+
+	s.n -= h.errs.n
+	s.sum -= h.errs.sum
+	s.sumSq -= h.errs.sumSq
+	s.overflow -= h.errs.overflow
+	for i, c := range h.errs.values {
+		s.values[i] -= c
+	}
+	s.minValue, s.maxValue = h.okMin, h.okMax
+	if s.n == 0 {
+		s.minValue, s.maxValue, s.sum, s.sumSq = 0, 0, 0, 0
+	}
+	return s
+}
+
+// Failures returns a new histogram with only the error values in this histogram.
+func (h *Histogram) Failures() *Histogram {
+	var f *Histogram
+	if h.errs == nil {
+		f = newEmpty(h.max, h.scale, h.digits)
+	} else {
+		f = h.errs.clone()
+		f.errClasses = cloneErrClasses(h.errClasses)
+	}
+	f.start, f.end = h.start, h.end
+	return f
+}
+
+// clone returns a deep copy of the histogram.
+func (h *Histogram) clone() *Histogram {
+	c := *h
+	c.values = append([]int(nil), h.values...)
+	if h.errs != nil {
+		c.errs = h.errs.clone()
+	}
+	c.errClasses = cloneErrClasses(h.errClasses)
+	return &c
+}
+
+func cloneErrClasses(errClasses map[string]*ErrorClassStats) map[string]*ErrorClassStats {
+	c := make(map[string]*ErrorClassStats, len(errClasses))
+	for class, stats := range errClasses {
+		c[class] = &ErrorClassStats{stats.Count, append([]string(nil), stats.Examples...)}
+	}
+	return c
+}
+
+// Merge adds all the values and errors in the other histogram to this one, and extends this
+// histogram's start and end times to cover the other's. The histograms must have the same bucketing,
+// which means they were created by the same constructor with the same arguments.
+func (h *Histogram) Merge(o *Histogram) error {
+	if h.scale != o.scale || h.max != o.max || h.digits != o.digits {
+		return fmt.Errorf("cannot merge histograms with different bucketing")
+	}
+
+	if len(o.values) > len(h.values) {
+		h.values = append(h.values, make([]int, len(o.values)-len(h.values))...)
+	}
+	for i, c := range o.values {
+		h.values[i] += c
+	}
+	if ok := o.n - o.errCnt; ok > 0 {
+		if h.n-h.errCnt == 0 || o.okMin < h.okMin {
+			h.okMin = o.okMin
+		}
+		if h.n-h.errCnt == 0 || o.okMax > h.okMax {
+			h.okMax = o.okMax
+		}
+	}
+	if o.errs != nil {
+		if h.errs == nil {
+			h.errs = newEmpty(h.max, h.scale, h.digits)
+		}
+		if err := h.errs.Merge(o.errs); err != nil {
+			return err
+		}
+	}
+	if o.n > 0 {
+		if h.n == 0 || o.minValue < h.minValue {
+			h.minValue = o.minValue
+		}
+		if h.n == 0 || o.maxValue > h.maxValue {
+			h.maxValue = o.maxValue
+		}
+	}
+	h.n += o.n
+	h.errCnt += o.errCnt
+	h.sum += o.sum
+	h.sumSq += o.sumSq
+	h.overflow += o.overflow
+	for class, stats := range o.errClasses {
+		hs, ok := h.errClasses[class]
+		if !ok {
+			hs = &ErrorClassStats{}
+			h.errClasses[class] = hs
+		}
+		hs.Count += stats.Count
+		for _, ex := range stats.Examples {
+			if len(hs.Examples) < maxErrorExamples {
+				hs.Examples = append(hs.Examples, ex)
+			}
+		}
+	}
+
+	if h.start == 0 || (o.start != 0 && o.start < h.start) {
+		h.start = o.start
+	}
+	if o.end > h.end {
+		h.end = o.end
+	}
+	return nil
+}
+
+// AddErrorClass adds a new error value to the histogram, and counts it in the given error class,
+// keeping the message as an example if there are only a few examples for the class so far.
+func (h *Histogram) AddErrorClass(v int, class, message string) {
+	h.AddError(v)
+	stats, ok := h.errClasses[class]
+	if !ok {
+		stats = &ErrorClassStats{}
+		h.errClasses[class] = stats
+	}
+	stats.Count++
+	if len(stats.Examples) < maxErrorExamples {
+		stats.Examples = append(stats.Examples, message)
+	}
 }
 
-// Percentiles produces the values for the given percentiles.
+// ErrorClasses returns the error counts and examples for each error class added with
+// AddErrorClass. The returned map must not be modified.
+func (h *Histogram) ErrorClasses() map[string]*ErrorClassStats {
+	return h.errClasses
+}
+
+// sortedOrder returns the indexes of the percentiles in ascending order of the percentiles, so
+// that they can be computed in a single pass without sorting the caller's slice.
+func sortedOrder(percentiles []float64) []int {
+	order := make([]int, len(percentiles))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return percentiles[order[i]] < percentiles[order[j]]
+	})
+	return order
+}
+
+// Percentiles produces the values for the given percentiles, which are the upper bounds of the
+// buckets containing those percentiles, in the same order as the percentiles.
 func (h *Histogram) Percentiles(percentiles ...float64) []int {
 	result := make([]int, len(percentiles))
-	if percentiles == nil || len(percentiles) == 0 {
+	if len(percentiles) == 0 {
 		return result
 	}
 
-	sort.Sort(sort.Float64Slice(percentiles))
-
+	order := sortedOrder(percentiles)
 	accum := 0
-	idx := int(math.Max(1.0, percentiles[0]*float64(h.n)))
+	idx := int(math.Max(1.0, percentiles[order[0]]*float64(h.n)))
 	for i, j := 0, 0; i < len(percentiles) && j < len(h.values); j++ {
 		accum += h.values[j]
 
 		for accum >= idx {
-			result[i] = j
+			result[order[i]] = h.value(j)
 			i++
 			if i >= len(percentiles) {
 				break
 			}
-			idx = int(math.Max(1.0, percentiles[i]*float64(h.n)))
+			idx = int(math.Max(1.0, percentiles[order[i]]*float64(h.n)))
 		}
 	}
 
 	return result
 }
 
-// Average returns the histogram's average value.
+// InterpolatedPercentiles produces the values for the given percentiles, in units of the
+// histogram's scale, in the same order as the percentiles. Each value is interpolated linearly
+// within the bucket that contains it, and the values are bounded by the exact minimum and maximum,
+// so the 0th and 100th percentiles are exact.
+func (h *Histogram) InterpolatedPercentiles(percentiles ...float64) []float64 {
+	result := make([]float64, len(percentiles))
+	if len(percentiles) == 0 || h.n == 0 {
+		return result
+	}
+
+	min, max := h.Min(), h.Max()
+	order := sortedOrder(percentiles)
+	accum := 0
+	for i, j := 0, 0; i < len(percentiles) && j < len(h.values); j++ {
+		c := h.values[j]
+		if c == 0 {
+			continue
+		}
+		for i < len(percentiles) {
+			rank := math.Max(0, math.Min(1, percentiles[order[i]])) * float64(h.n)
+			if rank > float64(accum+c) {
+				break
+			}
+			// The values in the bucket are assumed to be spread evenly over [low, high), with
+			// each value in the middle of its share of the range.
+			low := 0.0
+			if j > 0 {
+				low = float64(h.value(j-1) + 1)
+			}
+			high := float64(h.value(j) + 1)
+			pos := math.Max(0, rank-float64(accum)-0.5) / float64(c)
+			result[order[i]] = math.Max(min, math.Min(max, low+pos*(high-low)))
+			i++
+		}
+		accum += c
+	}
+	return result
+}
+
+// Min returns the exact smallest value in the histogram, in units of the histogram's scale.
+func (h *Histogram) Min() float64 {
+	return float64(h.minValue) / float64(h.scale)
+}
+
+// Max returns the exact largest value in the histogram, in units of the histogram's scale, which
+// may be larger than the histogram's max.
+func (h *Histogram) Max() float64 {
+	return float64(h.maxValue) / float64(h.scale)
+}
+
+// Overflow returns the number of values that were larger than the histogram's max, which are counted
+// in the max bucket. It is always zero for log-linear histograms.
+func (h *Histogram) Overflow() int {
+	return h.overflow
+}
+
+// Count returns the number of values in the histogram, including errors.
+func (h *Histogram) Count() int {
+	return h.n
+}
+
+// Errors returns the number of error values in the histogram.
+func (h *Histogram) Errors() int {
+	return h.errCnt
+}
+
+// Scale returns the scale of the histogram's values.
+func (h *Histogram) Scale() time.Duration {
+	return time.Duration(h.scale)
+}
+
+// Bucket is a non-empty bucket of a Histogram.
+type Bucket struct {
+	// The highest value counted in the bucket, in units of the histogram's scale.
+	Value int `json:"value"`
+	// The number of values in the bucket.
+	Count int `json:"count"`
+}
+
+// Buckets returns the non-empty buckets of the histogram in increasing order of value, so that the
+// distribution can be analyzed or compared with other histograms.
+func (h *Histogram) Buckets() []Bucket {
+	var buckets []Bucket
+	for i, c := range h.values {
+		if c > 0 {
+			buckets = append(buckets, Bucket{h.value(i), c})
+		}
+	}
+	return buckets
+}
+
+// Average returns the histogram's average value, in units of the histogram's scale.
 func (h *Histogram) Average() float64 {
-	return float64(h.total) / float64(h.n)
+	return h.sum / float64(h.n) / float64(h.scale)
+}
+
+// StdDev returns the (population) standard deviation of the histogram's values, in units of the
+// histogram's scale.
+func (h *Histogram) StdDev() float64 {
+	if h.n == 0 {
+		return math.NaN()
+	}
+	mean := h.sum / float64(h.n)
+	variance := math.Max(0, h.sumSq/float64(h.n)-mean*mean)
+	return math.Sqrt(variance) / float64(h.scale)
 }
 
 // ErrorPercent returns the hisogram's error percentage.
@@ -107,8 +479,96 @@ func (h *Histogram) ErrorPercent() float64 {
 	return float64(h.errCnt) / float64(h.n) * 100.0
 }
 
+// summaryPercentiles are the percentiles reported by Summary by default.
+var summaryPercentiles = []float64{0.5, 0.9, 0.95, 0.99, 0.999, 0.9999}
+
+// Percentile is the value of a percentile in a Summary.
+type Percentile struct {
+	// The percentile, between 0 and 1.
+	P float64 `json:"p"`
+	// The interpolated value of the percentile, in units of the histogram's scale.
+	Value float64 `json:"value"`
+}
+
+// Summary is a machine-readable summary of a Histogram. All values are in units of the histogram's
+// scale.
+type Summary struct {
+	Scale        time.Duration               `json:"scale"`
+	Count        int                         `json:"count"`
+	Errors       int                         `json:"errors"`
+	ErrorPercent float64                     `json:"error_percent"`
+	Overflow     int                         `json:"overflow"`
+	Min          float64                     `json:"min"`
+	Max          float64                     `json:"max"`
+	Mean         float64                     `json:"mean"`
+	StdDev       float64                     `json:"stddev"`
+	Percentiles  []Percentile                `json:"percentiles"`
+	Elapsed      time.Duration               `json:"elapsed"`
+	QPS          float64                     `json:"qps"`
+	ErrorClasses map[string]*ErrorClassStats `json:"error_classes,omitempty"`
+	// The summaries of the successful and failed values only, which are set in the summary of the
+	// whole histogram if it has any errors.
+	Success *Summary `json:"success,omitempty"`
+	Failure *Summary `json:"failure,omitempty"`
+	// The slowest and failed requests of the load test, which aren't part of the histogram, and are
+	// only set by the caller.
+	Exemplars *Exemplars `json:"exemplars,omitempty"`
+}
+
+// Summary returns a summary of the histogram with the interpolated values of the given percentiles,
+// or of the median, 90th, 95th, 99th, 99.9th and 99.99th percentiles if none are given. The mean,
+// standard deviation and error percentage of an empty histogram are zero. If the histogram has any
+// errors, the summary includes separate summaries of the successes and errors, since fast errors
+// would otherwise make a failing service look fast.
+func (h *Histogram) Summary(percentiles ...float64) *Summary {
+	if len(percentiles) == 0 {
+		percentiles = summaryPercentiles
+	}
+	s := h.summary(percentiles)
+	if h.errCnt > 0 {
+		s.Success = h.Successes().summary(percentiles)
+		s.Failure = h.Failures().summary(percentiles)
+	}
+	return s
+}
+
+func (h *Histogram) summary(percentiles []float64) *Summary {
+	s := &Summary{
+		Scale:        time.Duration(h.scale),
+		Count:        h.n,
+		Errors:       h.errCnt,
+		Overflow:     h.overflow,
+		Min:          h.Min(),
+		Max:          h.Max(),
+		Elapsed:      time.Duration(h.end - h.start),
+		ErrorClasses: h.errClasses,
+	}
+	if h.n > 0 {
+		s.ErrorPercent = h.ErrorPercent()
+		s.Mean = h.Average()
+		s.StdDev = h.StdDev()
+	}
+	if s.Elapsed > 0 {
+		s.QPS = float64(h.n) / s.Elapsed.Seconds()
+	}
+	for i, v := range h.InterpolatedPercentiles(percentiles...) {
+		s.Percentiles = append(s.Percentiles, Percentile{percentiles[i], v})
+	}
+	return s
+}
+
+// String returns a human-readable summary of the histogram, in units of its scale. The exact Min and
+// Max are shown along with the percentiles, which are interpolated within their buckets and clamped
+// to the exact min and max so that they never disagree with them, like when values overflow the max
+// of a linear histogram. All of them are truncated to integers. The statistics are followed by the
+// standard deviation, the number of overflowed values if any, and, if there are errors, the success
+// and error latencies, whose percentiles are computed the same way, and the counts of each error
+// class.
 func (h *Histogram) String() string {
-	ps := h.Percentiles(0.0, 0.5, 0.9, 0.95, 0.99, 0.999, 0.9999, 1.0)
+	ps := make([]int, 0, 6)
+	for _, p := range h.InterpolatedPercentiles(0.5, 0.9, 0.95, 0.99, 0.999, 0.9999) {
+		ps = append(ps, int(p))
+	}
 	s := "Percentiles (%s):\n" +
 		" Min:     %d\n" +
 		" Median:  %d\n" +
@@ -124,10 +584,56 @@ func (h *Histogram) String() string {
 		" Elapsed Time (sec): %.4f\n" +
 		" Average QPS: %.2f\n" +
 		" Errors: %d\n" +
-		" Percent errors: %.2f\n"
+		" Percent errors: %.2f\n" +
+		" Std Dev (%s): %f\n"
 	elapsedSecs := float64(h.end-h.start) / float64(time.Second)
 	averageQPS := float64(h.n) / elapsedSecs
 	scale := time.Duration(h.scale) * time.Nanosecond
-	return fmt.Sprintf(s, scale.String(), ps[0], ps[1], ps[2], ps[3], ps[4], ps[5], ps[6], ps[7],
-		scale.String(), h.Average(), h.n, elapsedSecs, averageQPS, h.errCnt, h.ErrorPercent())
+	overflow := ""
+	if h.overflow > 0 {
+		overflow = fmt.Sprintf(" Values over max (%d): %d\n", h.max, h.overflow)
+	}
+	return fmt.Sprintf(s, scale.String(), int(h.Min()), ps[0], ps[1], ps[2], ps[3], ps[4], ps[5], int(h.Max()),
+		scale.String(), h.Average(), h.n, elapsedSecs, averageQPS, h.errCnt, h.ErrorPercent(),
+		scale.String(), h.StdDev()) + overflow + h.outcomeString() + h.errorClassString()
+}
+
+// outcomeString returns a short summary of the success and error latencies, if there are errors.
+func (h *Histogram) outcomeString() string {
+	if h.errCnt == 0 {
+		return ""
+	}
+	var b strings.Builder
+	scale := time.Duration(h.scale) * time.Nanosecond
+	for _, o := range []struct {
+		name string
+		h    *Histogram
+	}{{"Successes", h.Successes()}, {"Errors", h.Failures()}} {
+		ps := o.h.InterpolatedPercentiles(0.5, 0.99)
+		fmt.Fprintf(&b, "%s (%s):\n Count: %d\n Min: %d, Median: %d, 99th: %d, Max: %d\n Average: %f\n",
+			o.name, scale.String(), o.h.n, int(o.h.Min()), int(ps[0]), int(ps[1]), int(o.h.Max()), o.h.Average())
+	}
+	return b.String()
+}
+
+func (h *Histogram) errorClassString() string {
+	if len(h.errClasses) == 0 {
+		return ""
+	}
+	classes := make([]string, 0, len(h.errClasses))
+	for class := range h.errClasses {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+
+	var b strings.Builder
+	b.WriteString("Errors by class:\n")
+	for _, class := range classes {
+		stats := h.errClasses[class]
+		fmt.Fprintf(&b, " %s: %d\n", class, stats.Count)
+		for _, ex := range stats.Examples {
+			fmt.Fprintf(&b, "  e.g. %s\n", ex)
+		}
+	}
+	return b.String()
 }
@@ -19,6 +19,7 @@ package hist
 import (
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestMinAndMax(t *testing.T) {
@@ -86,3 +87,213 @@ func TestString(t *testing.T) {
 		t.Error("Percentiles are not as expected")
 	}
 }
+
+func TestErrorClasses(t *testing.T) {
+	h := NewHistogram(10, 1)
+	h.Add(1)
+	for i := 0; i < 5; i++ {
+		h.AddErrorClass(1, "timeout", "i/o timeout")
+	}
+	h.AddErrorClass(1, "server_error", "500 Internal Server Error")
+
+	if h.ErrorPercent() != 6.0/7.0*100.0 {
+		t.Errorf("Actual(%f) != Expected(%f)", h.ErrorPercent(), 6.0/7.0*100.0)
+	}
+	timeouts := h.ErrorClasses()["timeout"]
+	if timeouts.Count != 5 || len(timeouts.Examples) != maxErrorExamples {
+		t.Errorf("Expected 5 timeouts with %d examples, got %+v", maxErrorExamples, timeouts)
+	}
+	s := h.String()
+	if !strings.Contains(s, " server_error: 1\n  e.g. 500 Internal Server Error\n") || !strings.Contains(s, " timeout: 5\n") {
+		t.Errorf("Error classes are not as expected:\n%s", s)
+	}
+}
+
+func TestLogHistogramRelativeError(t *testing.T) {
+	h := NewLogHistogram(3, 1)
+	for _, v := range []int{1, 999, 2047, 2048, 123456, 1e9, 6e10} {
+		h.Add(v)
+		p := h.Percentiles(1.0)[0]
+		if p < v || float64(p-v)/float64(v) > 0.001 {
+			t.Errorf("Actual(%d) is not within 0.1%% of Expected(%d)", p, v)
+		}
+	}
+	if len(h.values) > 50000 {
+		t.Errorf("Expected fewer than 50000 buckets, got %d", len(h.values))
+	}
+}
+
+func TestLogHistogramDistinctValues(t *testing.T) {
+	h := NewLogHistogram(2, 1000)
+	for i := 1; i <= 100; i++ {
+		h.Add(i * 1000)
+	}
+
+	ps := h.Percentiles(0.0, 0.01, 0.5, 0.95, 0.99, 1.0)
+	expected := []int{1, 1, 50, 95, 99, 100}
+	for i, p := range ps {
+		if p != expected[i] {
+			t.Errorf("Actual(%d) != Expected(%d)", p, expected[i])
+		}
+	}
+}
+
+func TestExactMinMaxAndOverflow(t *testing.T) {
+	h := NewHistogram(10, 10)
+	h.Add(25)
+	h.Add(250)
+	h.Add(1000)
+
+	if h.Min() != 2.5 || h.Max() != 100 || h.Overflow() != 2 {
+		t.Errorf("Expected min 2.5, max 100 and 2 overflows, got %f, %f and %d", h.Min(), h.Max(), h.Overflow())
+	}
+	if h.Average() != 42.5 {
+		t.Errorf("Actual(%f) != Expected(%f)", h.Average(), 42.5)
+	}
+	if !strings.Contains(h.String(), "Max:     100\n") || !strings.Contains(h.String(), "Values over max (10): 2\n") {
+		t.Errorf("Expected exact max and overflow count in:\n%s", h.String())
+	}
+}
+
+func TestStringPercentilesWithinMax(t *testing.T) {
+	h := NewLogHistogram(1, 1)
+	for _, v := range []int{1, 2, 3, 1001} {
+		h.Add(v)
+	}
+	if h.Percentiles(1.0)[0] <= 1001 {
+		t.Fatalf("Expected the max bucket to extend past the exact max, got %d", h.Percentiles(1.0)[0])
+	}
+	if s := h.String(); !strings.Contains(s, " 99.99th: 1001\n Max:     1001\n") {
+		t.Errorf("Expected percentiles no larger than the exact max in:\n%s", s)
+	}
+}
+
+func TestStdDev(t *testing.T) {
+	h := NewHistogram(10, 1)
+	for _, v := range []int{2, 4, 4, 4, 5, 5, 7, 9} {
+		h.Add(v)
+	}
+	if h.StdDev() != 2.0 {
+		t.Errorf("Actual(%f) != Expected(%f)", h.StdDev(), 2.0)
+	}
+}
+
+func TestPercentilesDoNotSortArgument(t *testing.T) {
+	h := NewHistogram(100, 1)
+	for i := 1; i <= 100; i++ {
+		h.Add(i)
+	}
+	percentiles := []float64{0.99, 0.5, 0.01}
+	ps := h.Percentiles(percentiles...)
+	if percentiles[0] != 0.99 || percentiles[2] != 0.01 {
+		t.Errorf("Expected percentiles to be unchanged, got %v", percentiles)
+	}
+	expected := []int{99, 50, 1}
+	for i, p := range ps {
+		if p != expected[i] {
+			t.Errorf("Actual(%d) != Expected(%d)", p, expected[i])
+		}
+	}
+}
+
+func TestInterpolatedPercentiles(t *testing.T) {
+	h := NewLogHistogram(1, 1)
+	for i := 0; i < 1000; i++ {
+		h.Add(1000 + i)
+	}
+	ps := h.InterpolatedPercentiles(0.0, 0.5, 1.0)
+	if ps[0] != 1000 || ps[2] != 1999 {
+		t.Errorf("Expected exact min and max, got %v", ps)
+	}
+	if ps[1] < 1450 || ps[1] > 1550 {
+		t.Errorf("Expected median within 1450-1550, got %f", ps[1])
+	}
+}
+
+func TestSummary(t *testing.T) {
+	h := NewHistogram(100, 1)
+	h.Start(0)
+	for i := 1; i <= 100; i++ {
+		h.Add(i)
+	}
+	h.AddErrorClass(50, "timeout", "i/o timeout")
+	h.End(int(2 * time.Second))
+
+	s := h.Summary(0.5, 0.99)
+	if s.Count != 101 || s.Errors != 1 || s.Min != 1 || s.Max != 100 || s.QPS != 50.5 {
+		t.Errorf("Unexpected summary %+v", s)
+	}
+	if len(s.Percentiles) != 2 || s.Percentiles[1].P != 0.99 || s.Percentiles[1].Value < 99 || s.Percentiles[1].Value > 100 {
+		t.Errorf("Unexpected percentiles %+v", s.Percentiles)
+	}
+	if s.ErrorClasses["timeout"].Count != 1 {
+		t.Errorf("Expected 1 timeout, got %+v", s.ErrorClasses)
+	}
+
+	empty := NewHistogram(10, 1).Summary()
+	if empty.Mean != 0 || len(empty.Percentiles) != len(summaryPercentiles) {
+		t.Errorf("Unexpected empty summary %+v", empty)
+	}
+}
+
+func TestSuccessAndErrorDistributions(t *testing.T) {
+	h := NewHistogram(1000, 1)
+	for i := 1; i <= 10; i++ {
+		h.Add(100 * i)
+		h.AddError(i)
+	}
+
+	ok, errs := h.Successes(), h.Failures()
+	if ok.Count() != 10 || ok.Errors() != 0 || ok.Min() != 100 || ok.Max() != 1000 || ok.Average() != 550 {
+		t.Errorf("Unexpected successes: count %d, min %f, max %f, average %f", ok.Count(), ok.Min(), ok.Max(), ok.Average())
+	}
+	if errs.Count() != 10 || errs.ErrorPercent() != 100 || errs.Min() != 1 || errs.Max() != 10 || errs.Average() != 5.5 {
+		t.Errorf("Unexpected errors: count %d, min %f, max %f, average %f", errs.Count(), errs.Min(), errs.Max(), errs.Average())
+	}
+	if p := ok.Percentiles(0.5)[0]; p != 500 {
+		t.Errorf("Actual(%d) != Expected(%d)", p, 500)
+	}
+	if h.Count() != 20 || h.Percentiles(0.5)[0] != 10 {
+		t.Errorf("Expected the combined view to include both, got count %d and median %d", h.Count(), h.Percentiles(0.5)[0])
+	}
+
+	s := h.Summary()
+	if s.Success == nil || s.Failure == nil || s.Success.Min != 100 || s.Failure.Max != 10 {
+		t.Errorf("Expected separate success and error summaries, got %+v and %+v", s.Success, s.Failure)
+	}
+	if !strings.Contains(h.String(), "Successes (1ns):\n Count: 10\n Min: 100, Median: 500, 99th: 1000, Max: 1000\n") {
+		t.Errorf("Expected a successes section in:\n%s", h.String())
+	}
+	if NewHistogram(10, 1).Summary().Success != nil {
+		t.Error("Expected no separate summaries without errors")
+	}
+}
+
+func TestBuckets(t *testing.T) {
+	h := NewLogHistogram(1, int(time.Millisecond))
+	for _, v := range []int{3, 3, 5, 100} {
+		h.Add(v * int(time.Millisecond))
+	}
+	b := h.Buckets()
+	if len(b) != 3 || b[0] != (Bucket{3, 2}) || b[1] != (Bucket{5, 1}) || b[2].Value < 100 || b[2].Count != 1 {
+		t.Errorf("Unexpected buckets %v", b)
+	}
+	if h.Scale() != time.Millisecond {
+		t.Errorf("Unexpected scale %v", h.Scale())
+	}
+}
+
+func TestStringOutcomes(t *testing.T) {
+	h := NewLogHistogram(1, 1)
+	for _, v := range []int{1, 2, 3} {
+		h.Add(v)
+	}
+	h.AddError(1001)
+	s := h.String()
+	if !strings.Contains(s, "Min: 1001, Median: 1001, 99th: 1001, Max: 1001\n") {
+		t.Errorf("Expected error percentiles within the exact max in:\n%s", s)
+	}
+	if !strings.Contains(s, " Percent errors: 25.00\n Std Dev (1ns): ") {
+		t.Errorf("Expected the std dev after the existing stats in:\n%s", s)
+	}
+}
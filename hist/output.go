@@ -0,0 +1,108 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hist
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// PercentileName returns the conventional name of a percentile between 0 and 1, like "p99.9" for
+// 0.999.
+func PercentileName(p float64) string {
+	return "p" + strconv.FormatFloat(math.Round(p*1e6)/1e4, 'f', -1, 64)
+}
+
+// WriteJSON writes the summary to w as indented JSON.
+func (s *Summary) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// WriteCSV writes the summary to w as CSV, with a header row and a row for all the values. If the
+// summary has separate success and failure summaries, they are written as two more rows. The
+// outcome column identifies the rows as "all", "success" or "failure".
+func (s *Summary) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := []string{"outcome", "count", "errors", "error_percent", "overflow", "min", "max", "mean", "stddev"}
+	for _, p := range s.Percentiles {
+		header = append(header, PercentileName(p.P))
+	}
+	header = append(header, "elapsed_sec", "qps", "scale_ns")
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	rows := []struct {
+		outcome string
+		s       *Summary
+	}{{"all", s}, {"success", s.Success}, {"failure", s.Failure}}
+	for _, r := range rows {
+		if r.s == nil {
+			continue
+		}
+		row := []string{
+			r.outcome,
+			strconv.Itoa(r.s.Count),
+			strconv.Itoa(r.s.Errors),
+			formatFloat(r.s.ErrorPercent),
+			strconv.Itoa(r.s.Overflow),
+			formatFloat(r.s.Min),
+			formatFloat(r.s.Max),
+			formatFloat(r.s.Mean),
+			formatFloat(r.s.StdDev),
+		}
+		for _, p := range r.s.Percentiles {
+			row = append(row, formatFloat(p.Value))
+		}
+		row = append(row, formatFloat(r.s.Elapsed.Seconds()), formatFloat(r.s.QPS), strconv.FormatInt(int64(r.s.Scale), 10))
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteBenchmark writes the summary to w as a line in the Go benchmark format, so that the results
+// of load tests can be compared with tools like benchstat. The mean latency is reported in ns/op,
+// followed by the percentiles (like p99-ns), the throughput in qps and the error percentage. The
+// name is prefixed with "Benchmark" if it isn't already, and must not contain spaces.
+func (s *Summary) WriteBenchmark(w io.Writer, name string) error {
+	if !strings.HasPrefix(name, "Benchmark") {
+		name = "Benchmark" + name
+	}
+	scale := float64(s.Scale)
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\t%d\t%s ns/op", name, s.Count, formatFloat(s.Mean*scale))
+	for _, p := range s.Percentiles {
+		fmt.Fprintf(&b, "\t%s %s-ns", formatFloat(p.Value*scale), PercentileName(p.P))
+	}
+	fmt.Fprintf(&b, "\t%s qps\t%s %%errors\n", formatFloat(s.QPS), formatFloat(s.ErrorPercent))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hist
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSummary() *Summary {
+	h := NewHistogram(100, int(time.Millisecond))
+	h.Start(0)
+	for i := 1; i <= 4; i++ {
+		h.Add(i * int(time.Millisecond))
+	}
+	h.AddError(2 * int(time.Millisecond))
+	h.End(int(time.Second))
+	return h.Summary(0.5, 0.999)
+}
+
+func TestPercentileName(t *testing.T) {
+	for p, name := range map[float64]string{0.5: "p50", 0.29: "p29", 0.999: "p99.9", 1.0: "p100"} {
+		if PercentileName(p) != name {
+			t.Errorf("Actual(%s) != Expected(%s)", PercentileName(p), name)
+		}
+	}
+}
+
+func TestSummaryJSON(t *testing.T) {
+	var b bytes.Buffer
+	if err := testSummary().WriteJSON(&b); err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	var s Summary
+	if err := json.Unmarshal(b.Bytes(), &s); err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	if s.Count != 5 || s.QPS != 5 || s.Success.Count != 4 || s.Failure.Count != 1 || s.Percentiles[1].P != 0.999 {
+		t.Errorf("Unexpected decoded summary %+v", s)
+	}
+}
+
+func TestSummaryCSV(t *testing.T) {
+	var b bytes.Buffer
+	if err := testSummary().WriteCSV(&b); err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected a header and 3 rows, got:\n%s", b.String())
+	}
+	if lines[0] != "outcome,count,errors,error_percent,overflow,min,max,mean,stddev,p50,p99.9,elapsed_sec,qps,scale_ns" {
+		t.Errorf("Unexpected header %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[3], "failure,1,1,100,0,2,2,2,0,2,2,1,1,1000000") {
+		t.Errorf("Unexpected failure row %q", lines[3])
+	}
+}
+
+func TestSummaryBenchmark(t *testing.T) {
+	var b bytes.Buffer
+	if err := testSummary().WriteBenchmark(&b, "Echo"); err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	expected := "BenchmarkEcho\t5\t2400000 ns/op\t2500000 p50-ns\t4000000 p99.9-ns"
+	if !strings.HasPrefix(b.String(), expected) || !strings.HasSuffix(b.String(), "\t5 qps\t20 %errors\n") {
+		t.Errorf("Unexpected benchmark line %q", b.String())
+	}
+}
+
+func TestExemplars(t *testing.T) {
+	e := &Exemplars{
+		Slowest: []Exemplar{{Start: 0, End: int64(time.Second), Latency: time.Second, Target: "a:80", Request: "GET /slow"}},
+		Errors:  []Exemplar{{Start: 0, End: 1, Latency: 1, ErrorClass: "timeout", Error: "timed out"}},
+	}
+	s := testSummary()
+	s.Exemplars = e
+	var b bytes.Buffer
+	if err := s.WriteJSON(&b); err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	var decoded Summary
+	if err := json.Unmarshal(b.Bytes(), &decoded); err != nil || decoded.Exemplars == nil ||
+		decoded.Exemplars.Slowest[0] != e.Slowest[0] || decoded.Exemplars.Errors[0] != e.Errors[0] {
+		t.Errorf("Unexpected decoded exemplars %+v (%v)", decoded.Exemplars, err)
+	}
+
+	b.Reset()
+	if err := e.WriteText(&b); err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 7 || lines[0] != "Slowest requests:" || lines[4] != "Failed requests:" {
+		t.Fatalf("Unexpected exemplars text:\n%s", b.String())
+	}
+	if f := strings.Fields(lines[2]); f[1] != "1s" || f[2] != "a:80" || f[5] != "-" {
+		t.Errorf("Unexpected slowest request row %q", lines[2])
+	}
+	if !strings.HasSuffix(lines[6], "timeout: timed out") {
+		t.Errorf("Unexpected failed request row %q", lines[6])
+	}
+}
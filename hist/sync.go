@@ -0,0 +1,137 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hist
+
+import (
+	"sync"
+	"time"
+)
+
+// SyncHistogram is a Histogram that is safe for concurrent use, so that it can be read, for live
+// reporting, while a recorder is still adding values to it.
+type SyncHistogram struct {
+	mu sync.Mutex
+	h  *Histogram
+}
+
+// NewSyncHistogram creates a SyncHistogram that adds values to the given histogram, which must not
+// be used directly afterwards.
+func NewSyncHistogram(h *Histogram) *SyncHistogram {
+	return &SyncHistogram{h: h}
+}
+
+// Start starts the histogram with the given value.
+func (s *SyncHistogram) Start(t int) {
+	s.mu.Lock()
+	s.h.Start(t)
+	s.mu.Unlock()
+}
+
+// End ends the histogram with the given value.
+func (s *SyncHistogram) End(t int) {
+	s.mu.Lock()
+	s.h.End(t)
+	s.mu.Unlock()
+}
+
+// Add adds a new value to the histogram.
+func (s *SyncHistogram) Add(v int) {
+	s.mu.Lock()
+	s.h.Add(v)
+	s.mu.Unlock()
+}
+
+// AddError adds a new error value to the histogram.
+func (s *SyncHistogram) AddError(v int) {
+	s.mu.Lock()
+	s.h.AddError(v)
+	s.mu.Unlock()
+}
+
+// AddErrorClass adds a new error value to the histogram, and counts it in the given error class.
+func (s *SyncHistogram) AddErrorClass(v int, class, message string) {
+	s.mu.Lock()
+	s.h.AddErrorClass(v, class, message)
+	s.mu.Unlock()
+}
+
+// Merge adds all the values and errors in the other histogram to this one.
+func (s *SyncHistogram) Merge(o *Histogram) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.h.Merge(o)
+}
+
+// Snapshot returns a copy of the current state of the histogram, which can be read without
+// blocking the recorder. If the histogram hasn't ended yet, the snapshot ends now, so its QPS is the
+// throughput so far.
+func (s *SyncHistogram) Snapshot() *Histogram {
+	s.mu.Lock()
+	c := s.h.clone()
+	s.mu.Unlock()
+	if c.end <= c.start {
+		c.end = int(time.Now().UnixNano())
+	}
+	return c
+}
+
+// SnapshotAndReset returns a copy of the current state of the histogram, like Snapshot, and
+// atomically resets the histogram to empty, so each snapshot holds only the values added since the
+// previous one, which is useful for interval reporting. The snapshot ends now, and the reset
+// histogram starts now.
+func (s *SyncHistogram) SnapshotAndReset() *Histogram {
+	now := int(time.Now().UnixNano())
+	s.mu.Lock()
+	c := s.h
+	s.h = newEmpty(c.max, c.scale, c.digits)
+	s.h.start = now
+	s.mu.Unlock()
+	if c.end <= c.start {
+		c.end = now
+	}
+	return c
+}
+
+// Percentiles produces the values for the given percentiles.
+func (s *SyncHistogram) Percentiles(percentiles ...float64) []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.h.Percentiles(percentiles...)
+}
+
+// Average returns the histogram's average value.
+func (s *SyncHistogram) Average() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.h.Average()
+}
+
+// ErrorPercent returns the histogram's error percentage.
+func (s *SyncHistogram) ErrorPercent() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.h.ErrorPercent()
+}
+
+func (s *SyncHistogram) String() string {
+	return s.Snapshot().String()
+}
+
+// Summary returns a summary of the histogram, see Histogram.Summary.
+func (s *SyncHistogram) Summary(percentiles ...float64) *Summary {
+	return s.Snapshot().Summary(percentiles...)
+}
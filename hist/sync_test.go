@@ -0,0 +1,66 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hist
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSyncHistogramConcurrentSnapshots(t *testing.T) {
+	s := NewSyncHistogram(NewHistogram(100, 1))
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 1; i <= 100; i++ {
+				s.Add(i)
+				s.Snapshot().Percentiles(0.5)
+			}
+		}()
+	}
+	wg.Wait()
+
+	snap := s.Snapshot()
+	if snap.n != 400 {
+		t.Errorf("Actual(%d) != Expected(%d)", snap.n, 400)
+	}
+	snap.Add(1)
+	if s.Snapshot().n != 400 {
+		t.Error("Expected the snapshot to be independent of the histogram")
+	}
+}
+
+func TestSyncHistogramSnapshotAndReset(t *testing.T) {
+	s := NewSyncHistogram(NewLogHistogram(3, 1))
+	s.Start(1)
+	for i := 1; i <= 10; i++ {
+		s.Add(i)
+	}
+	s.AddErrorClass(5, "timeout", "i/o timeout")
+
+	snap := s.SnapshotAndReset()
+	if snap.n != 11 || snap.errCnt != 1 || snap.end <= snap.start {
+		t.Errorf("Expected an ended snapshot with 11 values and 1 error, got %d values and %d errors", snap.n, snap.errCnt)
+	}
+	s.Add(3)
+	snap = s.SnapshotAndReset()
+	if snap.n != 1 || snap.errCnt != 0 || len(snap.ErrorClasses()) != 0 {
+		t.Errorf("Expected 1 value and no errors after reset, got %d values and %d errors", snap.n, snap.errCnt)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pinterest/bender"
+)
+
+// readBody reads the whole body of the response and replaces it with an in-memory copy, so that it
+// can be read again by the validator, other extractors or the caller.
+func readBody(resp *http.Response) ([]byte, error) {
+	if resp.Body == nil {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, err
+}
+
+func response(res interface{}) (*http.Response, error) {
+	resp, ok := res.(*http.Response)
+	if !ok {
+		return nil, fmt.Errorf("invalid response type %T, want: *http.Response", res)
+	}
+	return resp, nil
+}
+
+// HeaderExtractor creates an Extractor that returns the value of the named response header.
+func HeaderExtractor(name string) bender.Extractor {
+	return func(res interface{}) (interface{}, error) {
+		resp, err := response(res)
+		if err != nil {
+			return nil, err
+		}
+		v := resp.Header.Get(name)
+		if v == "" {
+			return nil, fmt.Errorf("header %s not found", name)
+		}
+		return v, nil
+	}
+}
+
+// RegexExtractor creates an Extractor that matches the regular expression against the response
+// body, and returns the first submatch, or the whole match if the expression has no groups.
+func RegexExtractor(re *regexp.Regexp) bender.Extractor {
+	return func(res interface{}) (interface{}, error) {
+		resp, err := response(res)
+		if err != nil {
+			return nil, err
+		}
+		body, err := readBody(resp)
+		if err != nil {
+			return nil, err
+		}
+		m := re.FindSubmatch(body)
+		if m == nil {
+			return nil, fmt.Errorf("no match for %s", re)
+		}
+		if len(m) > 1 {
+			return string(m[1]), nil
+		}
+		return string(m[0]), nil
+	}
+}
+
+// JSONPathExtractor creates an Extractor that decodes the response body as JSON and returns the
+// value at the given path. Paths are a dot-separated list of object keys and array indexes, with an
+// optional leading "$", like "$.items[0].id" or "items.0.id". Numbers are returned as json.Number
+// so that large IDs keep their precision.
+func JSONPathExtractor(path string) bender.Extractor {
+	keys := splitJSONPath(path)
+	return func(res interface{}) (interface{}, error) {
+		resp, err := response(res)
+		if err != nil {
+			return nil, err
+		}
+		body, err := readBody(resp)
+		if err != nil {
+			return nil, err
+		}
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			switch node := v.(type) {
+			case map[string]interface{}:
+				var ok bool
+				if v, ok = node[key]; !ok {
+					return nil, fmt.Errorf("path %s: key %q not found", path, key)
+				}
+			case []interface{}:
+				i, err := strconv.Atoi(key)
+				if err != nil || i < 0 || i >= len(node) {
+					return nil, fmt.Errorf("path %s: invalid index %q", path, key)
+				}
+				v = node[i]
+			default:
+				return nil, fmt.Errorf("path %s: cannot index %T with %q", path, v, key)
+			}
+		}
+		return v, nil
+	}
+}
+
+// splitJSONPath splits a path like "$.items[0].id" into its keys: "items", "0", "id".
+func splitJSONPath(path string) []string {
+	path = strings.TrimPrefix(path, "$")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	var keys []string
+	for _, key := range strings.Split(path, ".") {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
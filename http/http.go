@@ -17,16 +17,133 @@ limitations under the License.
 package http
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
 	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptrace"
+	"sync"
+	"time"
 
 	"github.com/pinterest/bender"
+	"github.com/pinterest/bender/trace"
 )
 
 // ResponseValidator validates an HTTP response.
 type ResponseValidator func(request interface{}, resp *http.Response) error
 
-// CreateExecutor creates an HTTP request executor.
+// routeKey is the context key of the route of a request.
+type routeKey struct{}
+
+// WithRoute returns a shallow copy of the request with the given route, like "/users/:id", which
+// the executor uses as the request's bender.TagRoute tag instead of its path, so that requests for
+// different resources of the same endpoint are grouped together.
+func WithRoute(req *http.Request, route string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), routeKey{}, route))
+}
+
+// InjectTraceparent is a trace.Injector for *http.Request requests, which returns a copy of the
+// request with the traceparent header set.
+func InjectTraceparent(request interface{}, traceparent string) (interface{}, error) {
+	req, ok := request.(*http.Request)
+	if !ok {
+		return nil, fmt.Errorf("invalid request type %T, want: *http.Request", request)
+	}
+	req = req.Clone(req.Context())
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	req.Header.Set(trace.Header, traceparent)
+	return req, nil
+}
+
+// requestTags returns the tags of a request: its host, method and route.
+func requestTags(req *http.Request) map[string]string {
+	route, ok := req.Context().Value(routeKey{}).(string)
+	if !ok {
+		route = req.URL.Path
+	}
+	return map[string]string{bender.TagTarget: req.URL.Host, bender.TagMethod: req.Method, bender.TagRoute: route}
+}
+
+// phaseTrace collects the durations of the phases of a request from the hooks of an
+// httptrace.ClientTrace, which may be called from other goroutines.
+type phaseTrace struct {
+	mu     sync.Mutex
+	start  map[string]time.Time
+	phases map[string]time.Duration
+}
+
+func newPhaseTrace() *phaseTrace {
+	return &phaseTrace{start: make(map[string]time.Time), phases: make(map[string]time.Duration)}
+}
+
+// begin starts timing a phase, unless it has already started, like a connection to the second
+// address of a host.
+func (t *phaseTrace) begin(phase string) {
+	t.mu.Lock()
+	if _, ok := t.start[phase]; !ok {
+		t.start[phase] = time.Now()
+	}
+	t.mu.Unlock()
+}
+
+// end ends the timing of a phase, if it has started.
+func (t *phaseTrace) end(phase string) {
+	t.mu.Lock()
+	if start, ok := t.start[phase]; ok {
+		t.phases[phase] = time.Since(start)
+	}
+	t.mu.Unlock()
+}
+
+// result returns a copy of the durations of the phases that have ended.
+func (t *phaseTrace) result() map[string]time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	phases := make(map[string]time.Duration, len(t.phases))
+	for k, v := range t.phases {
+		phases[k] = v
+	}
+	return phases
+}
+
+func (t *phaseTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { t.begin(bender.PhaseDNS) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { t.end(bender.PhaseDNS) },
+		ConnectStart:         func(string, string) { t.begin(bender.PhaseConnect) },
+		ConnectDone:          func(string, string, error) { t.end(bender.PhaseConnect) },
+		TLSHandshakeStart:    func() { t.begin(bender.PhaseTLS) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.end(bender.PhaseTLS) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.begin(bender.PhaseTTFB) },
+		GotFirstResponseByte: func() { t.end(bender.PhaseTTFB) },
+	}
+}
+
+// CreateExecutor creates an HTTP request executor, which reads the whole body of each response
+// before it is validated, so that the latency includes the transfer of the body. The body is
+// replaced with an in-memory copy, which validators and extractors can read. Its responses are
+// *http.Response values, and the response is returned along with the error if it failed validation.
 func CreateExecutor(tr *http.Transport, client *http.Client, responseValidator ResponseValidator) bender.RequestExecutor {
+	return createExecutor(tr, client, responseValidator, false)
+}
+
+// CreateTaggedExecutor creates an HTTP request executor like CreateExecutor, whose responses are
+// *bender.TaggedResponse values holding the *http.Response, tagged with the host (bender.TagTarget),
+// the method (bender.TagMethod) and the route (bender.TagRoute) of the request, and with the
+// durations of its phases: the DNS lookup, connection and TLS handshake, for requests that don't
+// reuse a connection, the time from writing the request to the first byte of the response, and the
+// time to read the body (bender.PhaseDNS, PhaseConnect, PhaseTLS, PhaseTTFB and PhaseBody). Requests
+// that fail without a response are tagged as well, with a nil *http.Response. The load test unwraps
+// the responses into the Tags and Phases of its EndRequestEvents, and code that calls the executor
+// directly gets the *http.Response with bender.UnwrapResponse.
+func CreateTaggedExecutor(tr *http.Transport, client *http.Client, responseValidator ResponseValidator) bender.RequestExecutor {
+	return createExecutor(tr, client, responseValidator, true)
+}
+
+func createExecutor(tr *http.Transport, client *http.Client, responseValidator ResponseValidator, tag bool) bender.RequestExecutor {
 	if tr == nil {
 		tr = &http.Transport{}
 		client = &http.Client{Transport: tr}
@@ -36,14 +153,91 @@ func CreateExecutor(tr *http.Transport, client *http.Client, responseValidator R
 
 	return func(_ int64, request interface{}) (interface{}, error) {
 		req := request.(*http.Request)
+		pt := newPhaseTrace()
+		if tag {
+			req = req.WithContext(httptrace.WithClientTrace(req.Context(), pt.clientTrace()))
+		}
+		response := func(resp *http.Response) interface{} {
+			if tag {
+				res := bender.TagResponse(resp, requestTags(req))
+				res.Phases = pt.result()
+				return res
+			}
+			if resp == nil {
+				return nil
+			}
+			return resp
+		}
+
 		resp, err := client.Do(req)
 		if err != nil {
-			return nil, err
+			return response(nil), bender.TagNetworkError(err)
+		}
+		pt.begin(bender.PhaseBody)
+		_, err = readBody(resp)
+		pt.end(bender.PhaseBody)
+		if err != nil {
+			return response(resp), bender.TagNetworkError(err)
 		}
 		err = responseValidator(request, resp)
+		if err != nil {
+			return response(resp), bender.TagError(statusErrorClass(resp.StatusCode), err)
+		}
+		return response(resp), nil
+	}
+}
+
+// statusErrorClass returns the class of a validation error for a response with the given status.
+func statusErrorClass(status int) bender.ErrorClass {
+	switch {
+	case status >= 500:
+		return bender.ErrorClassServer
+	case status >= 400:
+		return bender.ErrorClassClient
+	}
+	return bender.ErrorClassValidation
+}
+
+// sessionJarVar is the session variable holding the session's cookie jar.
+const sessionJarVar = "http.cookies"
+
+// SessionJar returns the cookie jar for the session, creating it on first use.
+func SessionJar(s *bender.Session) http.CookieJar {
+	if jar, ok := s.Get(sessionJarVar).(http.CookieJar); ok {
+		return jar
+	}
+	jar, _ := cookiejar.New(nil)
+	s.Set(sessionJarVar, jar)
+	return jar
+}
+
+// WithCookies wraps a session step that sends *http.Request requests, so that the cookies stored in
+// the session's cookie jar are added to the request, and the cookies set by the response are saved
+// in the jar for later steps.
+func WithCookies(step bender.SessionStep) bender.SessionStep {
+	request, response := step.Request, step.Response
+	step.Request = func(s *bender.Session) (interface{}, error) {
+		r, err := request(s)
 		if err != nil {
 			return nil, err
 		}
-		return resp, nil
+		req, ok := r.(*http.Request)
+		if !ok {
+			return nil, fmt.Errorf("invalid request type %T, want: *http.Request", r)
+		}
+		for _, c := range SessionJar(s).Cookies(req.URL) {
+			req.AddCookie(c)
+		}
+		return req, nil
+	}
+	step.Response = func(s *bender.Session, r interface{}) error {
+		if resp, ok := r.(*http.Response); ok && resp.Request != nil {
+			SessionJar(s).SetCookies(resp.Request.URL, resp.Cookies())
+		}
+		if response != nil {
+			return response(s, r)
+		}
+		return nil
 	}
+	return step
 }
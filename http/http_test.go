@@ -0,0 +1,239 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pinterest/bender"
+	"github.com/pinterest/bender/trace"
+)
+
+func jsonResponse(body string) *http.Response {
+	return &http.Response{
+		Header: http.Header{"Location": []string{"/items/7"}},
+		Body:   ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestJSONPathExtractor(t *testing.T) {
+	resp := jsonResponse(`{"items": [{"id": 12345678901234567}, {"id": 2}]}`)
+	v, err := JSONPathExtractor("$.items[0].id")(resp)
+	if err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	if v != json.Number("12345678901234567") {
+		t.Errorf("Actual(%v) != Expected(%v)", v, "12345678901234567")
+	}
+
+	v, err = JSONPathExtractor("items.1.id")(resp)
+	if err != nil || v != json.Number("2") {
+		t.Errorf("Expected the body to be readable again, got (%v, %v)", v, err)
+	}
+
+	if _, err := JSONPathExtractor("items.2.id")(resp); err == nil {
+		t.Error("Expected an error for an index out of range")
+	}
+}
+
+func TestRegexExtractor(t *testing.T) {
+	v, err := RegexExtractor(regexp.MustCompile(`token=(\w+)`))(jsonResponse("token=abc123; path=/"))
+	if err != nil || v != "abc123" {
+		t.Errorf("Actual(%v, %v) != Expected(%v)", v, err, "abc123")
+	}
+}
+
+func TestHeaderExtractor(t *testing.T) {
+	v, err := HeaderExtractor("Location")(jsonResponse(""))
+	if err != nil || v != "/items/7" {
+		t.Errorf("Actual(%v, %v) != Expected(%v)", v, err, "/items/7")
+	}
+	if _, err := HeaderExtractor("Missing")(jsonResponse("")); err == nil {
+		t.Error("Expected an error for a missing header")
+	}
+}
+
+func TestExtractorTypeCheck(t *testing.T) {
+	_, err := HeaderExtractor("Location")(42)
+	if err == nil || err.Error() != "invalid response type int, want: *http.Response" {
+		t.Errorf("Expected extractor to fail with invalid response type error, got (%v)", err)
+	}
+}
+
+func TestExecutorErrorClass(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	executor := CreateExecutor(nil, nil, func(_ interface{}, resp *http.Response) error {
+		return errors.New(resp.Status)
+	})
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	res, err := executor(0, req)
+	if class := bender.ClassifyError(err); class != bender.ErrorClassServer {
+		t.Errorf("Actual(%q) != Expected(%q)", class, bender.ErrorClassServer)
+	}
+	if resp, ok := res.(*http.Response); !ok || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected the response that failed validation, got %+v", res)
+	}
+
+	server.Close()
+	req, _ = http.NewRequest("GET", server.URL, nil)
+	res, err = executor(0, req)
+	if class := bender.ClassifyError(err); class != bender.ErrorClassConnRefused {
+		t.Errorf("Actual(%q) != Expected(%q)", class, bender.ErrorClassConnRefused)
+	}
+	if res != nil {
+		t.Errorf("Expected no response without a connection, got %+v", res)
+	}
+}
+
+func TestExecutorTags(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	executor := CreateTaggedExecutor(nil, nil, func(interface{}, *http.Response) error { return nil })
+	req, _ := http.NewRequest("POST", server.URL+"/users/42", nil)
+	for _, tc := range []struct {
+		req   *http.Request
+		route string
+	}{{req, "/users/42"}, {WithRoute(req, "/users/:id"), "/users/:id"}} {
+		res, err := executor(0, tc.req)
+		tr, ok := res.(*bender.TaggedResponse)
+		if err != nil || !ok {
+			t.Fatalf("Expected a tagged response, got (%v, %v)", res, err)
+		}
+		if _, ok := tr.Response.(*http.Response); !ok {
+			t.Errorf("Expected an *http.Response, got %T", tr.Response)
+		}
+		want := map[string]string{bender.TagTarget: req.URL.Host, bender.TagMethod: "POST", bender.TagRoute: tc.route}
+		if !reflect.DeepEqual(tr.Tags, want) {
+			t.Errorf("Actual(%v) != Expected(%v)", tr.Tags, want)
+		}
+	}
+}
+
+func TestInjectTraceparent(t *testing.T) {
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get(trace.Header)
+	}))
+	defer server.Close()
+
+	var traceparent string
+	executor := trace.NewExecutor(CreateTaggedExecutor(nil, nil, func(interface{}, *http.Response) error { return nil }), 1,
+		func(request interface{}, tp string) (interface{}, error) {
+			traceparent = tp
+			return InjectTraceparent(request, tp)
+		})
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	res, err := executor(0, req)
+	if err != nil || header == "" || header != traceparent || req.Header.Get(trace.Header) != "" {
+		t.Fatalf("Expected the server to get traceparent %q on a copy of the request, got (%q, %v)", traceparent, header, err)
+	}
+	sc, _ := trace.ParseTraceparent(header)
+	if tags := res.(*bender.TaggedResponse).Tags; tags[trace.TagTraceID] != sc.TraceID.String() || tags[bender.TagTarget] == "" {
+		t.Errorf("Expected the response to have the trace and executor tags, got %v", tags)
+	}
+}
+
+func TestExecutorPhases(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello "))
+		w.(http.Flusher).Flush()
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("world"))
+	})
+	for _, server := range []*httptest.Server{httptest.NewServer(handler), httptest.NewTLSServer(handler)} {
+		defer server.Close()
+		tls := server.TLS != nil
+
+		var body string
+		executor := CreateTaggedExecutor(server.Client().Transport.(*http.Transport), server.Client(), func(_ interface{}, resp *http.Response) error {
+			b, err := ioutil.ReadAll(resp.Body)
+			body = string(b)
+			return err
+		})
+		for i := 0; i < 2; i++ {
+			req, _ := http.NewRequest("GET", server.URL, nil)
+			res, err := executor(0, req)
+			if err != nil || body != "hello world" {
+				t.Fatalf("Expected the validator to read the body, got (%q, %v)", body, err)
+			}
+			phases := res.(*bender.TaggedResponse).Phases
+			if phases[bender.PhaseBody] < 20*time.Millisecond || phases[bender.PhaseTTFB] <= 0 || phases[bender.PhaseTTFB] >= 20*time.Millisecond {
+				t.Errorf("Expected the body read to include the delay, got %v", phases)
+			}
+			_, connected := phases[bender.PhaseConnect]
+			_, handshake := phases[bender.PhaseTLS]
+			if connected != (i == 0) || handshake != (tls && i == 0) {
+				t.Errorf("Expected a connection (and TLS handshake) for the first request only, got %v for request %d", phases, i)
+			}
+		}
+	}
+}
+
+func TestWithCookies(t *testing.T) {
+	var seen []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "42"})
+			return
+		}
+		c, err := r.Cookie("sid")
+		if err != nil {
+			seen = append(seen, "")
+		} else {
+			seen = append(seen, c.Value)
+		}
+	}))
+	defer server.Close()
+
+	executor := CreateExecutor(nil, nil, func(interface{}, *http.Response) error { return nil })
+	step := func(path string) bender.SessionStep {
+		return WithCookies(bender.SessionStep{
+			Name: path,
+			Request: func(*bender.Session) (interface{}, error) {
+				return http.NewRequest("GET", server.URL+path, nil)
+			},
+			Exec: executor,
+		})
+	}
+	recorder := make(chan interface{}, 10)
+	login := bender.NewSessionExecutor(recorder, step("/login"), step("/check"))
+	check := bender.NewSessionExecutor(recorder, step("/check"))
+
+	if _, err := login(0, bender.NewSession()); err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	if _, err := check(0, bender.NewSession()); err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	if !reflect.DeepEqual(seen, []string{"42", ""}) {
+		t.Errorf("Expected the cookie in the same session only, got %q", seen)
+	}
+}
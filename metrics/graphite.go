@@ -0,0 +1,110 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GraphiteRecorder is a recorder that aggregates the statistics of a load test, and periodically
+// pushes them over TCP to a Graphite server in the plaintext protocol. It pushes the same metrics as
+// a StatsDRecorder, with the outcome as the last part of the requests metric path:
+//
+//	bender.requests.success 120 1700000000
+//	bender.latency_ms.p99 12.5 1700000000
+//
+// Its Record method is the Recorder, and Close must be called after the load test to push the
+// remaining metrics and close the connection. If a push fails, the recorder reconnects to the server
+// and retries it once, and otherwise reconnects at the next push.
+type GraphiteRecorder struct {
+	*pusher
+	addr   string
+	prefix string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewGraphiteRecorder creates a GraphiteRecorder that pushes metrics to the Graphite server at addr
+// every interval, which must be positive.
+func NewGraphiteRecorder(addr, prefix string, interval time.Duration) (*GraphiteRecorder, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid push interval %v", interval)
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	g := &GraphiteRecorder{addr: addr, prefix: prefix, conn: conn}
+	g.pusher = newPusher(interval, g.write)
+	return g, nil
+}
+
+func (g *GraphiteRecorder) write(samples []sample, now time.Time) error {
+	var b strings.Builder
+	for _, smp := range samples {
+		path := g.prefix + "." + smp.name
+		if smp.outcome != "" {
+			path += "." + smp.outcome
+		}
+		fmt.Fprintf(&b, "%s %s %d\n", path, formatFloat(smp.value), now.Unix())
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	err := g.send(b.String())
+	if err != nil {
+		err = g.send(b.String())
+	}
+	return err
+}
+
+// send writes the data to the connection to the server, dialing it first if needed. The connection
+// is closed and dropped after a failed write, so that the next send redials the server.
+func (g *GraphiteRecorder) send(data string) error {
+	if g.conn == nil {
+		conn, err := net.Dial("tcp", g.addr)
+		if err != nil {
+			return err
+		}
+		g.conn = conn
+	}
+	if _, err := g.conn.Write([]byte(data)); err != nil {
+		g.conn.Close()
+		g.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Close pushes the remaining metrics and closes the connection to the server.
+func (g *GraphiteRecorder) Close() error {
+	g.close()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.conn != nil {
+		if err := g.conn.Close(); err != nil {
+			return err
+		}
+		g.conn = nil
+	}
+	return g.Err()
+}
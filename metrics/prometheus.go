@@ -0,0 +1,242 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics provides recorders that export the statistics of a load test to monitoring
+// systems, so that long-running load tests can be watched on existing dashboards.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pinterest/bender"
+)
+
+// DefaultBuckets are the default latency histogram buckets (in seconds) of a PrometheusRecorder.
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// A Tagger returns a label value for a request, like the route or target host.
+type Tagger func(*bender.EndRequestEvent) string
+
+// promHistogram is a cumulative Prometheus histogram.
+type promHistogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// PrometheusRecorder is a recorder that exposes the statistics of a load test in the Prometheus
+// text exposition format. It is an http.Handler, so it can be served on a /metrics endpoint:
+//
+//	p := metrics.NewPrometheusRecorder("bender", nil, nil)
+//	http.Handle("/metrics", p)
+//	go http.ListenAndServe(":9090", nil)
+//	bender.Record(recorder, p.Record)
+//
+// It exports these metrics, prefixed by the namespace:
+//
+//	requests_total{outcome,tag}                     counter of requests by outcome and tag
+//	request_duration_seconds{outcome,tag}           histogram of request latencies
+//	requests_in_flight                              gauge of requests that have started but not ended
+//	overage_seconds                                 gauge of the overage of the last WaitEvent
+//	target_rate                                     gauge of the target throughput, see SetTargetRate
+//	workers                                         gauge of the number of workers, see SetWorkers
+//	running                                         1 between the StartEvent and EndEvent, 0 otherwise
+//
+// The outcome label is "success" for successful requests, and the ErrorClass of failed ones. The tag
+// label is the value returned by the Tagger, or empty if there is no Tagger.
+type PrometheusRecorder struct {
+	namespace string
+	buckets   []float64
+	tag       Tagger
+
+	mu         sync.Mutex
+	requests   map[[2]string]uint64
+	latencies  map[[2]string]*promHistogram
+	inFlight   int64
+	overage    float64
+	targetRate float64
+	workers    float64
+	running    float64
+}
+
+// NewPrometheusRecorder creates a PrometheusRecorder whose metric names start with the namespace
+// (and an underscore), and whose latency histograms have the given bucket upper bounds, in
+// seconds and increasing order, or DefaultBuckets if buckets is nil. The tagger may be nil.
+func NewPrometheusRecorder(namespace string, buckets []float64, tagger Tagger) *PrometheusRecorder {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	return &PrometheusRecorder{
+		namespace: namespace,
+		buckets:   buckets,
+		tag:       tagger,
+		requests:  make(map[[2]string]uint64),
+		latencies: make(map[[2]string]*promHistogram),
+	}
+}
+
+// SetTargetRate sets the value of the target_rate gauge, which should be updated whenever the load
+// tester changes its target throughput.
+func (p *PrometheusRecorder) SetTargetRate(qps float64) {
+	p.mu.Lock()
+	p.targetRate = qps
+	p.mu.Unlock()
+}
+
+// SetWorkers sets the value of the workers gauge, which should be updated whenever the load tester
+// changes the number of workers, such as with WorkerSemaphore.Signal.
+func (p *PrometheusRecorder) SetWorkers(n int) {
+	p.mu.Lock()
+	p.workers = float64(n)
+	p.mu.Unlock()
+}
+
+// outcome returns the outcome label value of a request.
+func outcome(msg *bender.EndRequestEvent) string {
+	if msg.Err == nil {
+		return "success"
+	}
+	return string(msg.ErrorClass())
+}
+
+// Record updates the metrics with an event.
+func (p *PrometheusRecorder) Record(msg interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch msg := msg.(type) {
+	case *bender.StartEvent:
+		p.running = 1
+	case *bender.EndEvent:
+		p.running = 0
+	case *bender.WaitEvent:
+		p.overage = time.Duration(msg.Overage).Seconds()
+	case *bender.StartRequestEvent:
+		p.inFlight++
+	case *bender.EndRequestEvent:
+		p.inFlight--
+		tag := ""
+		if p.tag != nil {
+			tag = p.tag(msg)
+		}
+		key := [2]string{outcome(msg), tag}
+		p.requests[key]++
+
+		h, ok := p.latencies[key]
+		if !ok {
+			h = &promHistogram{counts: make([]uint64, len(p.buckets))}
+			p.latencies[key] = h
+		}
+		v := time.Duration(msg.End - msg.Start).Seconds()
+		for i, le := range p.buckets {
+			if v <= le {
+				h.counts[i]++
+			}
+		}
+		h.count++
+		h.sum += v
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (p *PrometheusRecorder) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p.WriteTo(w)
+}
+
+// WriteTo writes the metrics to w in the Prometheus text exposition format.
+func (p *PrometheusRecorder) WriteTo(w io.Writer) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var b strings.Builder
+	name := func(n string) string {
+		if p.namespace == "" {
+			return n
+		}
+		return p.namespace + "_" + n
+	}
+	header := func(n, help, typ string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name(n), help, name(n), typ)
+	}
+
+	header("requests_total", "Requests completed, by outcome and tag.", "counter")
+	for _, key := range sortedKeys(p.requests) {
+		fmt.Fprintf(&b, "%s{%s} %d\n", name("requests_total"), labels(key), p.requests[key])
+	}
+
+	header("request_duration_seconds", "Request latencies, by outcome and tag.", "histogram")
+	for _, key := range sortedKeys(p.requests) {
+		h := p.latencies[key]
+		l := labels(key)
+		for i, le := range p.buckets {
+			fmt.Fprintf(&b, "%s_bucket{%s,le=\"%s\"} %d\n", name("request_duration_seconds"), l, formatFloat(le), h.counts[i])
+		}
+		fmt.Fprintf(&b, "%s_bucket{%s,le=\"+Inf\"} %d\n", name("request_duration_seconds"), l, h.count)
+		fmt.Fprintf(&b, "%s_sum{%s} %s\n", name("request_duration_seconds"), l, formatFloat(h.sum))
+		fmt.Fprintf(&b, "%s_count{%s} %d\n", name("request_duration_seconds"), l, h.count)
+	}
+
+	gauges := []struct {
+		name, help string
+		value      float64
+	}{
+		{"requests_in_flight", "Requests that have started but not ended.", float64(p.inFlight)},
+		{"overage_seconds", "Overage of the last wait, a measure of how far the load tester is behind.", p.overage},
+		{"target_rate", "Target throughput in requests per second.", p.targetRate},
+		{"workers", "Number of workers sending requests.", p.workers},
+		{"running", "Whether a load test is running.", p.running},
+	}
+	for _, g := range gauges {
+		header(g.name, g.help, "gauge")
+		fmt.Fprintf(&b, "%s %s\n", name(g.name), formatFloat(g.value))
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func sortedKeys(m map[[2]string]uint64) [][2]string {
+	keys := make([][2]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	return keys
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels returns the outcome and tag labels for the key, escaped for the text exposition format.
+func labels(key [2]string) string {
+	return `outcome="` + labelEscaper.Replace(key[0]) + `",tag="` + labelEscaper.Replace(key[1]) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
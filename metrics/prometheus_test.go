@@ -0,0 +1,95 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pinterest/bender"
+)
+
+func testEvents() []interface{} {
+	ms := int64(time.Millisecond)
+	return []interface{}{
+		&bender.StartEvent{Start: 0},
+		&bender.WaitEvent{Wait: 10 * ms, Overage: 250 * ms},
+		&bender.StartRequestEvent{},
+		&bender.StartRequestEvent{},
+		&bender.StartRequestEvent{},
+		&bender.EndRequestEvent{Start: 0, End: 3 * ms, Response: "a"},
+		&bender.EndRequestEvent{Start: 0, End: 200 * ms, Response: "b"},
+		&bender.EndRequestEvent{Start: 0, End: 1 * ms, Err: bender.TagError(bender.ErrorClassTimeout, errors.New("timeout"))},
+		&bender.StartRequestEvent{},
+	}
+}
+
+func TestPrometheusScrape(t *testing.T) {
+	p := NewPrometheusRecorder("bender", []float64{0.005, 0.1}, func(e *bender.EndRequestEvent) string {
+		if e.Response == nil {
+			return ""
+		}
+		return e.Response.(string)
+	})
+	for _, msg := range testEvents() {
+		p.Record(msg)
+	}
+	p.SetTargetRate(100)
+	p.SetWorkers(4)
+
+	server := httptest.NewServer(p)
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	for _, line := range []string{
+		"# TYPE bender_requests_total counter",
+		`bender_requests_total{outcome="success",tag="a"} 1`,
+		`bender_requests_total{outcome="timeout",tag=""} 1`,
+		`bender_request_duration_seconds_bucket{outcome="success",tag="a",le="0.005"} 1`,
+		`bender_request_duration_seconds_bucket{outcome="success",tag="b",le="0.1"} 0`,
+		`bender_request_duration_seconds_bucket{outcome="success",tag="b",le="+Inf"} 1`,
+		`bender_request_duration_seconds_sum{outcome="success",tag="b"} 0.2`,
+		"bender_requests_in_flight 1",
+		"bender_overage_seconds 0.25",
+		"bender_target_rate 100",
+		"bender_workers 4",
+		"bender_running 1",
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("Expected %q in:\n%s", line, body)
+		}
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	if l := labels([2]string{"a\"b", "c\\d\ne"}); l != `outcome="a\"b",tag="c\\d\ne"` {
+		t.Errorf("Unexpected labels %s", l)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pinterest/bender"
+	"github.com/pinterest/bender/hist"
+)
+
+// sample is one metric value pushed by a push recorder.
+type sample struct {
+	// The name of the metric, relative to the recorder's prefix.
+	name string
+	// The outcome of the requests counted, for the requests counter only.
+	outcome string
+	value   float64
+	counter bool
+}
+
+// pushPercentiles are the latency percentiles pushed by the push recorders.
+var pushPercentiles = []float64{0.5, 0.9, 0.99}
+
+// pusher aggregates the events of a load test, and periodically pushes the aggregated metrics with
+// its write function, so that the push rate doesn't depend on the throughput of the load test.
+type pusher struct {
+	write func(samples []sample, now time.Time) error
+
+	mu       sync.Mutex
+	requests map[string]int
+	latency  *hist.Histogram
+	inFlight int64
+	overage  time.Duration
+	err      error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newPusher(interval time.Duration, write func([]sample, time.Time) error) *pusher {
+	p := &pusher{
+		write:    write,
+		requests: make(map[string]int),
+		latency:  newLatencyHistogram(),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go p.run(interval)
+	return p
+}
+
+func newLatencyHistogram() *hist.Histogram {
+	return hist.NewLogHistogram(2, int(time.Microsecond))
+}
+
+func (p *pusher) run(interval time.Duration) {
+	defer close(p.done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			p.flush()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// Record adds an event to the aggregated metrics. The metrics are pushed after the EndEvent, as well
+// as periodically.
+func (p *pusher) Record(msg interface{}) {
+	p.mu.Lock()
+	switch msg := msg.(type) {
+	case *bender.WaitEvent:
+		p.overage = time.Duration(msg.Overage)
+	case *bender.StartRequestEvent:
+		p.inFlight++
+	case *bender.EndRequestEvent:
+		p.inFlight--
+		p.requests[outcome(msg)]++
+		p.latency.Add(int(msg.End - msg.Start))
+	}
+	p.mu.Unlock()
+
+	if _, ok := msg.(*bender.EndEvent); ok {
+		p.flush()
+	}
+}
+
+// samples returns the samples for the metrics aggregated since the last call, and resets the
+// counters and latency histogram.
+func (p *pusher) samples() []sample {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var samples []sample
+	outcomes := make([]string, 0, len(p.requests))
+	for o := range p.requests {
+		outcomes = append(outcomes, o)
+	}
+	sort.Strings(outcomes)
+	for _, o := range outcomes {
+		samples = append(samples, sample{name: "requests", outcome: o, value: float64(p.requests[o]), counter: true})
+	}
+
+	if p.latency.Count() > 0 {
+		ms := float64(time.Millisecond / time.Microsecond)
+		for i, v := range p.latency.InterpolatedPercentiles(pushPercentiles...) {
+			samples = append(samples, sample{name: "latency_ms." + hist.PercentileName(pushPercentiles[i]), value: v / ms})
+		}
+		samples = append(samples,
+			sample{name: "latency_ms.max", value: p.latency.Max() / ms},
+			sample{name: "latency_ms.mean", value: p.latency.Average() / ms})
+	}
+	samples = append(samples,
+		sample{name: "in_flight", value: float64(p.inFlight)},
+		sample{name: "overage_ms", value: float64(p.overage) / float64(time.Millisecond)})
+
+	p.requests = make(map[string]int)
+	p.latency = newLatencyHistogram()
+	return samples
+}
+
+// flush pushes the aggregated metrics.
+func (p *pusher) flush() {
+	if err := p.write(p.samples(), time.Now()); err != nil {
+		p.mu.Lock()
+		p.err = err
+		p.mu.Unlock()
+	}
+}
+
+// Err returns the last error encountered while pushing metrics, if any.
+func (p *pusher) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// close stops the periodic pushes, and pushes the metrics aggregated since the last push.
+func (p *pusher) close() {
+	close(p.stop)
+	<-p.done
+	p.flush()
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pinterest/bender"
+)
+
+func assertLines(t *testing.T, got string, lines ...string) {
+	for _, line := range lines {
+		if !strings.Contains(got, line) {
+			t.Errorf("Expected %q in:\n%s", line, got)
+		}
+	}
+}
+
+func TestStatsDRecorder(t *testing.T) {
+	for _, tc := range []struct {
+		tags  []string
+		lines []string
+	}{
+		{nil, []string{
+			"bender.requests.success:2|c",
+			"bender.requests.timeout:1|c",
+			"bender.latency_ms.max:200|g",
+			"bender.in_flight:1|g",
+			"bender.overage_ms:250|g",
+		}},
+		{[]string{"env:test"}, []string{
+			"bender.requests:2|c|#outcome:success,env:test",
+			"bender.requests:1|c|#outcome:timeout,env:test",
+			"bender.latency_ms.max:200|g|#env:test",
+		}},
+	} {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Expected no error, got (%v)", err)
+		}
+		s, err := NewStatsDRecorder(conn.LocalAddr().String(), "bender", tc.tags, time.Hour)
+		if err != nil {
+			t.Fatalf("Expected no error, got (%v)", err)
+		}
+		for _, msg := range testEvents() {
+			s.Record(msg)
+		}
+		s.Record(&bender.EndEvent{})
+
+		buf := make([]byte, maxPacketSize)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Expected no error, got (%v)", err)
+		}
+		assertLines(t, string(buf[:n]), tc.lines...)
+
+		if err := s.Close(); err != nil {
+			t.Errorf("Expected no error, got (%v)", err)
+		}
+		conn.Close()
+	}
+}
+
+func TestGraphiteRecorder(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	defer l.Close()
+	received := make(chan string)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			received <- ""
+			return
+		}
+		data, _ := ioutil.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	g, err := NewGraphiteRecorder(l.Addr().String(), "bender", time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	for _, msg := range testEvents() {
+		g.Record(msg)
+	}
+	if err := g.Close(); err != nil {
+		t.Errorf("Expected no error, got (%v)", err)
+	}
+
+	assertLines(t, <-received,
+		"bender.requests.success 2 ",
+		"bender.requests.timeout 1 ",
+		"bender.latency_ms.max 200 ",
+		"bender.overage_ms 250 ")
+}
+
+func TestGraphiteReconnect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	defer l.Close()
+	received := make(chan string)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				data, _ := ioutil.ReadAll(conn)
+				received <- string(data)
+			}()
+		}
+	}()
+
+	g, err := NewGraphiteRecorder(l.Addr().String(), "bender", time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	// Break the connection, so that the next push fails and reconnects.
+	g.conn.Close()
+	if data := <-received; data != "" {
+		t.Errorf("Expected no data on the broken connection, got %q", data)
+	}
+	for _, msg := range testEvents() {
+		g.Record(msg)
+	}
+	if err := g.Close(); err != nil {
+		t.Errorf("Expected no error, got (%v)", err)
+	}
+	assertLines(t, <-received, "bender.requests.success 2 ")
+}
+
+func TestPushInterval(t *testing.T) {
+	if _, err := NewGraphiteRecorder("127.0.0.1:0", "bender", 0); err == nil {
+		t.Error("Expected an error for a zero Graphite push interval")
+	}
+	if _, err := NewStatsDRecorder("127.0.0.1:0", "bender", nil, -time.Second); err == nil {
+		t.Error("Expected an error for a negative StatsD push interval")
+	}
+}
+
+func TestPushAggregation(t *testing.T) {
+	p := &pusher{requests: make(map[string]int), latency: newLatencyHistogram()}
+	for _, msg := range testEvents() {
+		p.Record(msg)
+	}
+	if n := len(p.samples()); n != 9 {
+		t.Errorf("Expected 9 samples, got %d", n)
+	}
+	// The counters and latencies are reset after each push, but the gauges are kept.
+	samples := p.samples()
+	if len(samples) != 2 || samples[0].name != "in_flight" || samples[0].value != 1 {
+		t.Errorf("Unexpected samples after reset %+v", samples)
+	}
+}
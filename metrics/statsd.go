@@ -0,0 +1,120 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// maxPacketSize is the largest UDP payload sent to StatsD, which fits in a typical Ethernet MTU.
+const maxPacketSize = 1432
+
+// StatsDRecorder is a recorder that aggregates the statistics of a load test, and periodically
+// pushes them over UDP to a StatsD or DogStatsD server. It pushes the requests counter for each
+// outcome ("success" or the ErrorClass), the p50, p90, p99, max and mean latency in milliseconds
+// and the in-flight requests and overage as gauges, with names starting with the prefix:
+//
+//	bender.requests.success:120|c
+//	bender.latency_ms.p99:12.5|g
+//
+// With DogStatsD tags, the outcome is a tag instead of part of the name:
+//
+//	bender.requests:120|c|#outcome:success,env:test
+//
+// Its Record method is the Recorder, and Close must be called after the load test to push the
+// remaining metrics and close the connection.
+type StatsDRecorder struct {
+	*pusher
+	conn   net.Conn
+	prefix string
+	tags   []string
+}
+
+// NewStatsDRecorder creates a StatsDRecorder that pushes metrics to the StatsD server at addr every
+// interval, which must be positive. If tags is not nil, the metrics are sent in the DogStatsD format
+// with the given tags, like "env:test", added to each metric.
+func NewStatsDRecorder(addr, prefix string, tags []string, interval time.Duration) (*StatsDRecorder, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid push interval %v", interval)
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &StatsDRecorder{conn: conn, prefix: prefix, tags: tags}
+	s.pusher = newPusher(interval, s.write)
+	return s, nil
+}
+
+func (s *StatsDRecorder) line(smp sample) string {
+	name := s.prefix + "." + smp.name
+	typ := "g"
+	if smp.counter {
+		typ = "c"
+	}
+	if s.tags == nil {
+		if smp.outcome != "" {
+			name += "." + smp.outcome
+		}
+		return fmt.Sprintf("%s:%s|%s", name, formatFloat(smp.value), typ)
+	}
+
+	tags := s.tags
+	if smp.outcome != "" {
+		tags = append([]string{"outcome:" + smp.outcome}, tags...)
+	}
+	if len(tags) == 0 {
+		return fmt.Sprintf("%s:%s|%s", name, formatFloat(smp.value), typ)
+	}
+	return fmt.Sprintf("%s:%s|%s|#%s", name, formatFloat(smp.value), typ, strings.Join(tags, ","))
+}
+
+// write sends the samples in as few packets as possible.
+func (s *StatsDRecorder) write(samples []sample, _ time.Time) error {
+	var packet bytes.Buffer
+	for _, smp := range samples {
+		line := s.line(smp)
+		if packet.Len() > 0 && packet.Len()+1+len(line) > maxPacketSize {
+			if _, err := s.conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		_, err := s.conn.Write(packet.Bytes())
+		return err
+	}
+	return nil
+}
+
+// Close pushes the remaining metrics and closes the connection to the server.
+func (s *StatsDRecorder) Close() error {
+	s.close()
+	if err := s.conn.Close(); err != nil {
+		return err
+	}
+	return s.Err()
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bender
+
+import (
+	"math"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/pinterest/bender/hist"
+)
+
+// An Option configures a load test. Options make it possible to drive a very high throughput from a
+// single process, where sending several events through the recorder channel for every request would
+// be the bottleneck.
+type Option func(*options)
+
+type options struct {
+	requestRate, waitRate float64
+	newHist               func() *hist.Histogram
+	interval              time.Duration
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{requestRate: 1, waitRate: 1}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithRequestEventSampling sends the StartRequestEvent and EndRequestEvent for only the given
+// fraction of the requests, evenly spread over the load test. A rate of zero disables them.
+// Only the histogram and windowed recorders (with WithAggregation) and the EventLogWriter see every
+// request; the recorders that work from the EndRequestEvents, like the metrics, dashboard, breakdown
+// and exemplar recorders, only see the sampled requests, and undercount accordingly.
+func WithRequestEventSampling(rate float64) Option {
+	return func(o *options) {
+		o.requestRate = rate
+	}
+}
+
+// WithWaitEventSampling sends the WaitEvent for only the given fraction of the requests, evenly
+// spread over the load test. A rate of zero disables them. It has no effect on LoadTestConcurrency
+// and LoadTestVirtualUsers, which don't send WaitEvents.
+func WithWaitEventSampling(rate float64) Option {
+	return func(o *options) {
+		o.waitRate = rate
+	}
+}
+
+// WithAggregation adds the latency of every request to histograms created by newHist inside the load
+// test, which are sharded to avoid contention, and sends them to the recorder channel, merged, in a
+// HistogramEvent every interval and at the end of the load test. The StartEvent of the load test has
+// Aggregated set, so that the histogram and windowed recorders use the HistogramEvents and ignore
+// the EndRequestEvents, which can then be sampled or disabled without losing any latencies. The
+// histograms of those recorders must have the same bucketing as the histograms created by newHist,
+// which they check at the StartEvent, and they panic there if it doesn't, before any latency is
+// recorded, since they would otherwise silently lose every latency.
+func WithAggregation(newHist func() *hist.Histogram, interval time.Duration) Option {
+	return func(o *options) {
+		o.newHist = newHist
+		o.interval = interval
+	}
+}
+
+// HistogramEvent is sent periodically by load tests with aggregation enabled.
+type HistogramEvent struct {
+	// The Unix epoch times (in nanoseconds) of the start and end of the period.
+	Start, End int64
+	// The latencies of the requests that ended in the period.
+	Hist *hist.Histogram
+}
+
+// sampler picks an evenly spread fraction of its calls. It is not safe for concurrent use.
+type sampler struct {
+	rate float64
+	n    int64
+}
+
+// sample returns true for the calls at which the expected number of samples reaches a whole number.
+func (s *sampler) sample() bool {
+	if s.rate >= 1 {
+		return true
+	}
+	s.n++
+	return math.Floor(float64(s.n)*s.rate) > math.Floor(float64(s.n-1)*s.rate)
+}
+
+// aggregatorShards is the number of histograms the throughput and concurrency load tests aggregate
+// latencies into.
+func aggregatorShards() int {
+	return 4 * runtime.GOMAXPROCS(0)
+}
+
+type aggregatorShard struct {
+	mu sync.Mutex
+	h  *hist.Histogram
+}
+
+// aggregator adds request latencies to sharded histograms, and periodically sends them to the
+// recorder channel. The methods of a nil aggregator do nothing, so that the load tests can call them
+// whether aggregation is enabled or not.
+type aggregator struct {
+	newHist func() *hist.Histogram
+	shards  []*aggregatorShard
+	last    int64
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// aggregator returns a new aggregator with the given number of shards for a load test that started
+// at the given time, or nil if aggregation is disabled.
+func (o *options) aggregator(start int64, shards int) *aggregator {
+	if o.newHist == nil {
+		return nil
+	}
+	a := &aggregator{newHist: o.newHist, last: start, stop: make(chan struct{}), done: make(chan struct{})}
+	for i := 0; i < shards; i++ {
+		a.shards = append(a.shards, &aggregatorShard{h: o.newHist()})
+	}
+	return a
+}
+
+// startEvent returns the StartEvent of a load test that started at the given time.
+func (a *aggregator) startEvent(start int64) *StartEvent {
+	if a == nil {
+		return &StartEvent{Start: start}
+	}
+	return &StartEvent{Start: start, Aggregated: true, Hist: a.newHist()}
+}
+
+// add adds the latency of a request to the histogram of the given shard, which is taken modulo the
+// number of shards.
+func (a *aggregator) add(shard int, start, end int64, err error) {
+	if a == nil {
+		return
+	}
+	s := a.shards[shard%len(a.shards)]
+	s.mu.Lock()
+	if err == nil {
+		s.h.Add(int(end - start))
+	} else {
+		s.h.AddErrorClass(int(end-start), string(ClassifyError(err)), err.Error())
+	}
+	s.mu.Unlock()
+}
+
+// flush sends the latencies added since the last flush, if there are any, in a HistogramEvent. The
+// histograms of the shards are merged, and a histogram that can't be merged, because newHist doesn't
+// always return the same bucketing, is sent in its own HistogramEvent rather than being lost.
+func (a *aggregator) flush(recorder chan interface{}) {
+	now := time.Now().UnixNano()
+	send := func(h *hist.Histogram) {
+		h.Start(int(a.last))
+		h.End(int(now))
+		if h.Count() > 0 {
+			recorder <- &HistogramEvent{a.last, now, h}
+		}
+	}
+	merged := a.newHist()
+	for _, s := range a.shards {
+		s.mu.Lock()
+		h := s.h
+		s.h = a.newHist()
+		s.mu.Unlock()
+		if err := merged.Merge(h); err != nil {
+			send(h)
+		}
+	}
+	send(merged)
+	a.last = now
+}
+
+// run starts a goroutine that flushes the latencies every interval. If the interval isn't positive,
+// the latencies are only flushed at the end of the load test.
+func (a *aggregator) run(interval time.Duration, recorder chan interface{}) {
+	if a == nil {
+		return
+	}
+	if interval <= 0 {
+		close(a.done)
+		return
+	}
+	go func() {
+		defer close(a.done)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				a.flush(recorder)
+			case <-a.stop:
+				return
+			}
+		}
+	}()
+}
+
+// close stops the periodic flushes, and flushes the remaining latencies.
+func (a *aggregator) close(recorder chan interface{}) {
+	if a == nil {
+		return
+	}
+	close(a.stop)
+	<-a.done
+	a.flush(recorder)
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bender
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pinterest/bender/hist"
+)
+
+func newTestHist() *hist.Histogram {
+	return hist.NewLogHistogram(2, int(time.Microsecond))
+}
+
+func manyRequests(n int) chan interface{} {
+	rs := make([]interface{}, n)
+	for i := range rs {
+		rs[i] = Request{}
+	}
+	return requests(rs...)
+}
+
+func TestSampler(t *testing.T) {
+	for _, tc := range []struct {
+		rate float64
+		n    int
+	}{{1, 100}, {0, 0}, {0.25, 25}, {0.1, 10}} {
+		s := sampler{rate: tc.rate}
+		n := 0
+		for i := 0; i < 100; i++ {
+			if s.sample() {
+				n++
+			}
+		}
+		if n != tc.n {
+			t.Errorf("Expected %d samples at rate %f, got %d", tc.n, tc.rate, n)
+		}
+	}
+}
+
+func TestLoadTestThroughputAggregated(t *testing.T) {
+	cr := make(chan interface{})
+	LoadTestThroughput(UniformIntervalGenerator(1e6), manyRequests(50), noOpExec, cr,
+		WithRequestEventSampling(0), WithWaitEventSampling(0), WithAggregation(newTestHist, 0))
+
+	start, ok := (<-cr).(*StartEvent)
+	if !ok || !start.Aggregated {
+		t.Fatalf("Expected an aggregated StartEvent, got %+v", start)
+	}
+	assertMessages(t, cr, &HistogramEvent{}, &EndEvent{})
+}
+
+func TestLoadTestConcurrencyAggregated(t *testing.T) {
+	cr := make(chan interface{})
+	LoadTestConcurrency(workers(4), manyRequests(100), errorExec, cr,
+		WithRequestEventSampling(0.1), WithAggregation(newTestHist, time.Millisecond))
+
+	h := newTestHist()
+	ws := NewWindowedStats(time.Second, newTestHist)
+	events := 0
+	Record(cr, NewHistogramRecorder(h), NewWindowedRecorder(ws), func(msg interface{}) {
+		if _, ok := msg.(*EndRequestEvent); ok {
+			events++
+		}
+	})
+	if events != 10 {
+		t.Errorf("Expected 10 sampled EndRequestEvents, got %d", events)
+	}
+	if h.Count() != 100 || h.Errors() != 100 || h.ErrorClasses()["other"].Count != 100 {
+		t.Errorf("Expected all 100 requests in the histogram without double counting, got %d", h.Count())
+	}
+	if ws.Windows[0].Requests != 100 || ws.Windows[0].Errors != 100 || ws.Windows[0].Hist.Count() != 100 {
+		t.Errorf("Unexpected window %+v", ws.Windows[0])
+	}
+}
+
+func TestLoadTestVirtualUsersAggregated(t *testing.T) {
+	cr := make(chan interface{})
+	LoadTestVirtualUsers(3, nil, nil, manyRequests(30), noOpExec, cr, WithAggregation(newTestHist, time.Hour))
+
+	h := newTestHist()
+	events := 0
+	Record(cr, NewHistogramRecorder(h), func(msg interface{}) {
+		if _, ok := msg.(*EndRequestEvent); ok {
+			events++
+		}
+	})
+	if events != 30 || h.Count() != 30 {
+		t.Errorf("Expected 30 EndRequestEvents and 30 requests in the histogram, got %d and %d", events, h.Count())
+	}
+}
+
+func TestAggregatedBucketingMismatch(t *testing.T) {
+	for name, r := range map[string]Recorder{
+		"histogram": NewHistogramRecorder(hist.NewHistogram(1000, int(time.Millisecond))),
+		"windowed":  NewWindowedRecorder(NewWindowedStats(time.Second, func() *hist.Histogram { return hist.NewHistogram(1000, int(time.Millisecond)) })),
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected the %s recorder to panic on a StartEvent with a different bucketing", name)
+				}
+			}()
+			r(&StartEvent{Start: 0, Aggregated: true, Hist: newTestHist()})
+		}()
+	}
+}
+
+func TestAggregatorFlushMismatch(t *testing.T) {
+	// A newHist that doesn't always return the same bucketing.
+	n := 0
+	newHist := func() *hist.Histogram {
+		n++
+		if n%2 == 0 {
+			return hist.NewHistogram(1000, int(time.Millisecond))
+		}
+		return newTestHist()
+	}
+	a := newOptions([]Option{WithAggregation(newHist, 0)}).aggregator(0, 2)
+	a.add(0, 0, int64(time.Millisecond), nil)
+	a.add(1, 0, int64(time.Millisecond), nil)
+
+	recorder := make(chan interface{}, 10)
+	a.flush(recorder)
+	close(recorder)
+	count := 0
+	for msg := range recorder {
+		count += msg.(*HistogramEvent).Hist.Count()
+	}
+	if count != 2 {
+		t.Errorf("Expected the flushed histograms to have 2 requests, got %d", count)
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bender
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pinterest/bender/hist"
+)
+
+// The phases of a request timed by the HTTP executor.
+const (
+	// The DNS lookup of the host.
+	PhaseDNS = "dns"
+	// The TCP connection to the host.
+	PhaseConnect = "connect"
+	// The TLS handshake.
+	PhaseTLS = "tls"
+	// The time from the request being written to the first byte of the response.
+	PhaseTTFB = "ttfb"
+	// The time to read the body of the response.
+	PhaseBody = "body"
+)
+
+// phaseOrder is the order in which the known phases happen.
+var phaseOrder = []string{PhaseDNS, PhaseConnect, PhaseTLS, PhaseTTFB, PhaseBody}
+
+// PhaseStats holds a histogram of the durations of each phase of the requests of a load test. Phases
+// like the DNS lookup and the connection only happen for requests that don't reuse a connection, so
+// the number of requests with those phases shows how much the connections churn.
+type PhaseStats struct {
+	// The durations of each phase, by phase.
+	Hists map[string]*hist.Histogram
+	// The number of requests.
+	Requests int
+
+	newHist func() *hist.Histogram
+	start   int64
+}
+
+// NewPhaseStats creates empty PhaseStats, which use newHist to create the histogram for each phase.
+func NewPhaseStats(newHist func() *hist.Histogram) *PhaseStats {
+	return &PhaseStats{Hists: make(map[string]*hist.Histogram), newHist: newHist}
+}
+
+// Names returns the names of the phases, with the known phases first, in the order they happen,
+// followed by the other phases, sorted.
+func (p *PhaseStats) Names() []string {
+	var names, other []string
+	for _, name := range phaseOrder {
+		if _, ok := p.Hists[name]; ok {
+			names = append(names, name)
+		}
+	}
+	for name := range p.Hists {
+		known := false
+		for _, k := range phaseOrder {
+			known = known || k == name
+		}
+		if !known {
+			other = append(other, name)
+		}
+	}
+	sort.Strings(other)
+	return append(names, other...)
+}
+
+// WriteTable writes a table of the phases to w, with a row for each phase and columns for the number
+// and percentage of requests with the phase, and the mean and given percentiles of its duration in
+// milliseconds.
+func (p *PhaseStats) WriteTable(w io.Writer, percentiles ...float64) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	header := []string{"phase", "requests", "%requests", "mean"}
+	for _, pc := range percentiles {
+		header = append(header, hist.PercentileName(pc))
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, name := range p.Names() {
+		s := p.Hists[name].Summary(percentiles...)
+		ms := float64(s.Scale) / float64(time.Millisecond)
+		percent := 0.0
+		if p.Requests > 0 {
+			percent = float64(s.Count) / float64(p.Requests) * 100
+		}
+		row := []string{name, fmt.Sprint(s.Count), fmt.Sprintf("%.2f", percent), fmt.Sprintf("%.3f", s.Mean*ms)}
+		for _, pc := range s.Percentiles {
+			row = append(row, fmt.Sprintf("%.3f", pc.Value*ms))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// NewPhaseRecorder creates a new recorder that adds the duration of each phase of a request, from the
+// Phases of its EndRequestEvent, to the histogram of the phase in p.
+func NewPhaseRecorder(p *PhaseStats) Recorder {
+	return func(msg interface{}) {
+		switch msg := msg.(type) {
+		case *StartEvent:
+			p.start, p.Requests = msg.Start, 0
+			p.Hists = make(map[string]*hist.Histogram)
+		case *EndEvent:
+			for _, h := range p.Hists {
+				h.End(int(msg.End))
+			}
+		case *EndRequestEvent:
+			p.Requests++
+			for name, d := range msg.Phases {
+				h, ok := p.Hists[name]
+				if !ok {
+					h = p.newHist()
+					h.Start(int(p.start))
+					p.Hists[name] = h
+				}
+				h.Add(int(d))
+			}
+		}
+	}
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bender
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPhaseRecorder(t *testing.T) {
+	exec := func(_ int64, request interface{}) (interface{}, error) {
+		phases := map[string]time.Duration{PhaseTTFB: 3 * time.Millisecond, PhaseBody: time.Millisecond, "queue": time.Microsecond}
+		if request == "new" {
+			phases[PhaseConnect] = 2 * time.Millisecond
+		}
+		return &TaggedResponse{Phases: phases}, nil
+	}
+	cr := make(chan interface{})
+	LoadTestConcurrency(workers(1), requests("new", "reused", "reused", "reused"), exec, cr)
+
+	p := NewPhaseStats(newTestHist)
+	Record(cr, NewPhaseRecorder(p))
+
+	if p.Requests != 4 || p.Hists[PhaseConnect].Count() != 1 || p.Hists[PhaseTTFB].Count() != 4 {
+		t.Errorf("Unexpected phase stats for %d requests: %v", p.Requests, p.Hists)
+	}
+	if names := strings.Join(p.Names(), ","); names != "connect,ttfb,body,queue" {
+		t.Errorf("Actual(%s) != Expected(%s)", names, "connect,ttfb,body,queue")
+	}
+
+	var buf bytes.Buffer
+	if err := p.WriteTable(&buf, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 || strings.Join(strings.Fields(lines[0]), " ") != "phase requests %requests mean p50" {
+		t.Fatalf("Unexpected table:\n%s", buf.String())
+	}
+	if f := strings.Fields(lines[1]); f[0] != "connect" || f[1] != "1" || f[2] != "25.00" || !strings.HasPrefix(f[3], "2.0") {
+		t.Errorf("Unexpected row %q", lines[1])
+	}
+}
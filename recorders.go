@@ -17,6 +17,7 @@ limitations under the License.
 package bender
 
 import (
+	"fmt"
 	"log"
 
 	"github.com/pinterest/bender/hist"
@@ -45,21 +46,78 @@ func NewLoggingRecorder(l *log.Logger) Recorder {
 	}
 }
 
+// histogram is implemented by hist.Histogram and hist.SyncHistogram.
+type histogram interface {
+	Start(int)
+	End(int)
+	Add(int)
+	AddErrorClass(int, string, string)
+	Merge(*hist.Histogram) error
+}
+
+// addRequest adds the latency of a request to the histogram.
+func addRequest(h histogram, msg *EndRequestEvent) {
+	elapsed := int(msg.End - msg.Start)
+	if msg.Err == nil {
+		h.Add(elapsed)
+	} else {
+		h.AddErrorClass(elapsed, string(msg.ErrorClass()), msg.Err.Error())
+	}
+}
+
+// recordHistogram adds the latencies of a load test to the histogram, from the EndRequestEvents or,
+// if the load test aggregates the latencies itself, from the HistogramEvents. The aggregated flag is
+// set by the StartEvent.
+func recordHistogram(h histogram, aggregated *bool, msg interface{}) {
+	switch msg := msg.(type) {
+	case *StartEvent:
+		*aggregated = msg.Aggregated
+		checkAggregated(h, msg)
+		h.Start(int(msg.Start))
+	case *EndEvent:
+		h.End(int(msg.End))
+	case *EndRequestEvent:
+		if !*aggregated {
+			addRequest(h, msg)
+		}
+	case *HistogramEvent:
+		mergeAggregated(h, msg)
+	}
+}
+
+// checkAggregated checks at the StartEvent of an aggregated load test that the HistogramEvents can
+// be merged into h. The latencies of an aggregated load test are only sent in its HistogramEvents,
+// so rather than silently losing all of them when the histograms have a different bucketing, it
+// panics, before any latency is recorded.
+func checkAggregated(h histogram, msg *StartEvent) {
+	if msg.Aggregated && msg.Hist != nil {
+		if err := h.Merge(msg.Hist); err != nil {
+			panic(fmt.Sprintf("bender: %v: the histograms of WithAggregation must have the same bucketing as the recorder's", err))
+		}
+	}
+}
+
+// mergeAggregated merges the histogram of a HistogramEvent into h, whose bucketing checkAggregated
+// has already checked, unless the StartEvent had no Hist.
+func mergeAggregated(h histogram, msg *HistogramEvent) {
+	if err := h.Merge(msg.Hist); err != nil {
+		panic(fmt.Sprintf("bender: %v: the histograms of WithAggregation must have the same bucketing as the recorder's", err))
+	}
+}
+
 // NewHistogramRecorder creates a new hist.Histogram-based recorder.
 func NewHistogramRecorder(h *hist.Histogram) Recorder {
+	var aggregated bool
 	return func(msg interface{}) {
-		switch msg := msg.(type) {
-		case *StartEvent:
-			h.Start(int(msg.Start))
-		case *EndEvent:
-			h.End(int(msg.End))
-		case *EndRequestEvent:
-			elapsed := int(msg.End - msg.Start)
-			if msg.Err == nil {
-				h.Add(elapsed)
-			} else {
-				h.AddError(elapsed)
-			}
-		}
+		recordHistogram(h, &aggregated, msg)
+	}
+}
+
+// NewSyncHistogramRecorder creates a new hist.SyncHistogram-based recorder, which makes it possible to
+// read the histogram while the load test is running.
+func NewSyncHistogramRecorder(h *hist.SyncHistogram) Recorder {
+	var aggregated bool
+	return func(msg interface{}) {
+		recordHistogram(h, &aggregated, msg)
 	}
 }
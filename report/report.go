@@ -0,0 +1,407 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package report creates self-contained HTML reports of load tests, with charts of the latency and
+// throughput over time, the latency distribution and the errors, as well as the configuration of the
+// load test and the host it ran on. The charts are inline SVG images, so a report can be viewed
+// offline and attached to a review as a single file.
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/pinterest/bender"
+	"github.com/pinterest/bender/hist"
+)
+
+// defaultPercentiles are the latency percentiles charted over time if none are set.
+var defaultPercentiles = []float64{0.5, 0.9, 0.99}
+
+// Host describes the host that ran a load test.
+type Host struct {
+	Hostname   string
+	OS, Arch   string
+	NumCPU     int
+	GOMAXPROCS int
+	GoVersion  string
+}
+
+// CurrentHost returns a description of the current host.
+func CurrentHost() Host {
+	hostname, _ := os.Hostname()
+	return Host{
+		Hostname:   hostname,
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		GoVersion:  runtime.Version(),
+	}
+}
+
+// Report is an HTML report of a load test.
+type Report struct {
+	// The title of the report.
+	Title string
+	// The windowed stats of the load test.
+	Stats *bender.WindowedStats
+	// The configuration of the load test, like the target QPS and the service under test, which is
+	// shown as a table. It is optional.
+	Config map[string]string
+	// The host that ran the load test. The host section of the report is omitted if its hostname is
+	// empty.
+	Host Host
+	// The latency percentiles that are charted over time.
+	Percentiles []float64
+	// The slowest and failed requests of the load test, which are shown as tables. They are optional.
+	Exemplars *hist.Exemplars
+	// Warnings about the results, like those of the health package when the load generator itself
+	// likely skewed the latencies, which are shown at the top of the report.
+	Warnings []string
+}
+
+// New creates a report of the load test with the given windowed stats, which ran on the current host.
+func New(title string, ws *bender.WindowedStats) *Report {
+	return &Report{Title: title, Stats: ws, Host: CurrentHost(), Percentiles: defaultPercentiles}
+}
+
+// FromEventLog creates a report from an event log written by a bender.EventLogWriter, by replaying
+// it into windowed stats with windows of the given width and histograms created by newHist. The
+// event log doesn't record the host that ran the load test, so the report's Host is left empty, and
+// can be set by the caller.
+func FromEventLog(title string, r io.Reader, width time.Duration, newHist func() *hist.Histogram) (*Report, error) {
+	if width <= 0 {
+		return nil, fmt.Errorf("invalid window width %v", width)
+	}
+	ws := bender.NewWindowedStats(width, newHist)
+	if err := bender.ReplayEventLog(r, bender.NewWindowedRecorder(ws)); err != nil {
+		return nil, err
+	}
+	return &Report{Title: title, Stats: ws, Percentiles: defaultPercentiles}, nil
+}
+
+// keyValue is a row of a two-column table in the report.
+type keyValue struct {
+	Key, Value string
+}
+
+// errorRow is a row of the error breakdown table.
+type errorRow struct {
+	Class    string
+	Count    int
+	Percent  float64
+	Examples []string
+}
+
+// exemplarRow is a row of the slowest or failed requests tables.
+type exemplarRow struct {
+	Start, Latency, Target, Request, Response, Error string
+}
+
+func exemplarRows(exemplars []hist.Exemplar, start int64) []exemplarRow {
+	var rows []exemplarRow
+	for _, x := range exemplars {
+		errMsg := x.Error
+		if x.ErrorClass != "" {
+			errMsg = x.ErrorClass + ": " + errMsg
+		}
+		rows = append(rows, exemplarRow{
+			Start:    fmt.Sprintf("%.3f s", time.Duration(x.Start-start).Seconds()),
+			Latency:  formatMs(float64(x.Latency) / float64(time.Millisecond)),
+			Target:   x.Target,
+			Request:  x.Request,
+			Response: x.Response,
+			Error:    errMsg,
+		})
+	}
+	return rows
+}
+
+// view holds everything rendered by the report template.
+type view struct {
+	Title       string
+	Generated   string
+	Warnings    []string
+	Summary     []keyValue
+	Config      []keyValue
+	Host        []keyValue
+	Latency     template.HTML
+	Throughput  template.HTML
+	Percentiles template.HTML
+	Errors      []errorRow
+	ErrorChart  template.HTML
+	Slowest     []exemplarRow
+	Failed      []exemplarRow
+}
+
+// ms converts a value in units of the given scale to milliseconds.
+func ms(v float64, scale time.Duration) float64 {
+	return v * float64(scale) / float64(time.Millisecond)
+}
+
+func formatMs(v float64) string {
+	return fmt.Sprintf("%.3f ms", v)
+}
+
+// WriteHTML writes the report to w as a single HTML page.
+func (r *Report) WriteHTML(w io.Writer) error {
+	total, err := r.Stats.Total()
+	if err != nil {
+		return err
+	}
+	percentiles := r.Percentiles
+	if len(percentiles) == 0 {
+		percentiles = defaultPercentiles
+	}
+	summary := total.Summary(percentiles...)
+
+	v := &view{
+		Title:       r.Title,
+		Generated:   time.Now().Format(time.RFC1123),
+		Warnings:    r.Warnings,
+		Latency:     r.latencyChart(percentiles, summary.Scale),
+		Throughput:  r.throughputChart(),
+		Percentiles: percentileChart(total, summary.Scale),
+	}
+	if r.Host.Hostname != "" {
+		v.Host = []keyValue{
+			{"Hostname", r.Host.Hostname},
+			{"OS/Arch", r.Host.OS + "/" + r.Host.Arch},
+			{"CPUs", fmt.Sprint(r.Host.NumCPU)},
+			{"GOMAXPROCS", fmt.Sprint(r.Host.GOMAXPROCS)},
+			{"Go version", r.Host.GoVersion},
+		}
+	}
+
+	v.Summary = []keyValue{
+		{"Start", time.Unix(0, r.Stats.Start).Format(time.RFC3339)},
+		{"Duration", summary.Elapsed.String()},
+		{"Requests", fmt.Sprint(summary.Count)},
+		{"Errors", fmt.Sprintf("%d (%.2f%%)", summary.Errors, summary.ErrorPercent)},
+		{"Throughput", fmt.Sprintf("%.2f qps", summary.QPS)},
+		{"Min latency", formatMs(ms(summary.Min, summary.Scale))},
+		{"Mean latency", formatMs(ms(summary.Mean, summary.Scale))},
+	}
+	for _, p := range summary.Percentiles {
+		v.Summary = append(v.Summary, keyValue{hist.PercentileName(p.P) + " latency", formatMs(ms(p.Value, summary.Scale))})
+	}
+	maxOverage := int64(0)
+	for _, win := range r.Stats.Windows {
+		if win.MaxOverage > maxOverage {
+			maxOverage = win.MaxOverage
+		}
+	}
+	v.Summary = append(v.Summary,
+		keyValue{"Max latency", formatMs(ms(summary.Max, summary.Scale))},
+		keyValue{"Max overage", time.Duration(maxOverage).String()})
+
+	keys := make([]string, 0, len(r.Config))
+	for k := range r.Config {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v.Config = append(v.Config, keyValue{k, r.Config[k]})
+	}
+
+	var chart barChart
+	for class, stats := range total.ErrorClasses() {
+		v.Errors = append(v.Errors, errorRow{class, stats.Count, float64(stats.Count) / float64(total.Count()) * 100, stats.Examples})
+	}
+	sort.Slice(v.Errors, func(i, j int) bool {
+		if v.Errors[i].Count != v.Errors[j].Count {
+			return v.Errors[i].Count > v.Errors[j].Count
+		}
+		return v.Errors[i].Class < v.Errors[j].Class
+	})
+	for _, e := range v.Errors {
+		chart.labels = append(chart.labels, e.Class)
+		chart.values = append(chart.values, float64(e.Count))
+	}
+	if len(v.Errors) > 0 {
+		v.ErrorChart = chart.svg()
+	}
+
+	if r.Exemplars != nil {
+		v.Slowest = exemplarRows(r.Exemplars.Slowest, r.Stats.Start)
+		v.Failed = exemplarRows(r.Exemplars.Errors, r.Stats.Start)
+	}
+
+	return reportTemplate.Execute(w, v)
+}
+
+// seconds returns the time t as seconds since the start of the load test.
+func (r *Report) seconds(t int64) float64 {
+	return time.Duration(t - r.Stats.Start).Seconds()
+}
+
+func (r *Report) latencyChart(percentiles []float64, scale time.Duration) template.HTML {
+	c := &lineChart{title: "Latency", xLabel: "Time (s)", yLabel: "Latency (ms)"}
+	for _, p := range percentiles {
+		c.series = append(c.series, series{name: hist.PercentileName(p)})
+	}
+	for _, win := range r.Stats.Windows {
+		if win.Hist.Count() == 0 {
+			continue
+		}
+		for i, v := range win.Hist.InterpolatedPercentiles(percentiles...) {
+			c.series[i].points = append(c.series[i].points, point{r.seconds(win.Start), ms(v, scale)})
+		}
+	}
+	return c.svg()
+}
+
+func (r *Report) throughputChart() template.HTML {
+	c := &lineChart{title: "Throughput", xLabel: "Time (s)", yLabel: "Requests/s",
+		series: []series{{name: "requests"}, {name: "errors"}}}
+	for _, win := range r.Stats.Windows {
+		if win.End <= win.Start {
+			continue
+		}
+		x := r.seconds(win.Start)
+		c.series[0].points = append(c.series[0].points, point{x, win.QPS()})
+		c.series[1].points = append(c.series[1].points, point{x, float64(win.Errors) / win.Elapsed().Seconds()})
+	}
+	return c.svg()
+}
+
+// percentileChart plots the latency of each percentile from p0 to p99.99, on a scale that spreads out
+// the tail, for the successful and failed requests separately if there are any errors.
+func percentileChart(total *hist.Histogram, scale time.Duration) template.HTML {
+	const nines = 4
+	c := &lineChart{title: "Latency distribution", xLabel: "Percentile", yLabel: "Latency (ms)"}
+	for i := 0; i <= nines; i++ {
+		p := 1 - math.Pow(10, -float64(i))
+		c.xTicks = append(c.xTicks, tick{float64(i), hist.PercentileName(p)})
+	}
+
+	hists := []*hist.Histogram{total}
+	names := []string{"all"}
+	if total.Errors() > 0 {
+		hists = append(hists, total.Successes(), total.Failures())
+		names = append(names, "success", "error")
+	}
+	var xs, ps []float64
+	for x := 0.0; x <= nines+1e-9; x += 0.05 {
+		xs = append(xs, x)
+		ps = append(ps, 1-math.Pow(10, -x))
+	}
+	for i, h := range hists {
+		if h.Count() == 0 {
+			continue
+		}
+		s := series{name: names[i]}
+		for j, v := range h.InterpolatedPercentiles(ps...) {
+			s.points = append(s.points, point{xs[j], ms(v, scale)})
+		}
+		c.series = append(c.series, s)
+	}
+	return c.svg()
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Helvetica Neue", Arial, sans-serif; margin: 2em auto; max-width: 800px; color: #222; }
+h1 { font-size: 1.6em; margin-bottom: 0; }
+h2 { font-size: 1.2em; margin-top: 2em; border-bottom: 1px solid #ddd; }
+table { border-collapse: collapse; }
+td, th { padding: 3px 12px 3px 0; text-align: left; vertical-align: top; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+.generated { color: #777; }
+.warnings { background: #fff4e5; border-left: 4px solid #f0a020; padding: 0.5em 1em; }
+.examples { color: #555; font-family: monospace; font-size: 0.9em; }
+svg text { font-size: 11px; fill: #333; }
+svg .title { font-size: 13px; font-weight: bold; }
+svg .ytick { text-anchor: end; }
+svg .xtick, svg .xlabel, svg .ylabel { text-anchor: middle; }
+svg .grid { stroke: #eee; }
+svg .axis { stroke: #999; }
+svg .line { fill: none; stroke-width: 1.5; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="generated">Generated {{.Generated}}</p>
+{{if .Warnings}}
+<div class="warnings">
+<h2>Warnings</h2>
+<ul>
+{{range .Warnings}}<li>{{.}}</li>
+{{end}}</ul>
+</div>
+{{end}}
+<h2>Summary</h2>
+<table>
+{{range .Summary}}<tr><th>{{.Key}}</th><td class="num">{{.Value}}</td></tr>
+{{end}}</table>
+
+<h2>Latency over time</h2>
+{{.Latency}}
+
+<h2>Throughput over time</h2>
+{{.Throughput}}
+
+<h2>Latency distribution</h2>
+{{.Percentiles}}
+
+<h2>Errors</h2>
+{{if .Errors}}{{.ErrorChart}}
+<table>
+<tr><th>Class</th><th>Count</th><th>% of requests</th><th>Examples</th></tr>
+{{range .Errors}}<tr><td>{{.Class}}</td><td class="num">{{.Count}}</td><td class="num">{{printf "%.2f" .Percent}}</td><td class="examples">{{range .Examples}}{{.}}<br>{{end}}</td></tr>
+{{end}}</table>
+{{else}}<p>No errors.</p>
+{{end}}
+{{if .Slowest}}
+<h2>Slowest requests</h2>
+<table>
+<tr><th>Start</th><th>Latency</th><th>Target</th><th>Request</th><th>Response</th><th>Error</th></tr>
+{{range .Slowest}}<tr><td class="num">{{.Start}}</td><td class="num">{{.Latency}}</td><td>{{.Target}}</td><td class="examples">{{.Request}}</td><td class="examples">{{.Response}}</td><td class="examples">{{.Error}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if .Failed}}
+<h2>Failed requests</h2>
+<table>
+<tr><th>Start</th><th>Latency</th><th>Target</th><th>Request</th><th>Response</th><th>Error</th></tr>
+{{range .Failed}}<tr><td class="num">{{.Start}}</td><td class="num">{{.Latency}}</td><td>{{.Target}}</td><td class="examples">{{.Request}}</td><td class="examples">{{.Response}}</td><td class="examples">{{.Error}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if .Config}}
+<h2>Configuration</h2>
+<table>
+{{range .Config}}<tr><th>{{.Key}}</th><td>{{.Value}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if .Host}}
+<h2>Host</h2>
+<table>
+{{range .Host}}<tr><th>{{.Key}}</th><td>{{.Value}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,133 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package report
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pinterest/bender"
+	"github.com/pinterest/bender/hist"
+)
+
+func testEventLog() *bytes.Buffer {
+	var buf bytes.Buffer
+	l := bender.NewEventLogWriter(&buf, bender.EventLogBinary, nil)
+	sec, ms := int64(time.Second), int64(time.Millisecond)
+	l.Record(&bender.StartEvent{Start: 0})
+	for i := int64(0); i < 100; i++ {
+		t := i * sec / 20
+		l.Record(&bender.WaitEvent{Wait: 50 * ms, Overage: i * ms, Time: t})
+		var err error
+		if i%10 == 0 {
+			err = bender.TagError(bender.ErrorClassTimeout, errors.New("timed out <slowly>"))
+		}
+		l.Record(&bender.EndRequestEvent{Start: t, End: t + (i%7+1)*ms, Err: err})
+	}
+	l.Record(&bender.EndEvent{Start: 0, End: 5 * sec})
+	return &buf
+}
+
+func TestWriteHTML(t *testing.T) {
+	r, err := FromEventLog("Test <run>", testEventLog(), time.Second, func() *hist.Histogram {
+		return hist.NewLogHistogram(3, int(time.Microsecond))
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	r.Config = map[string]string{"target": "<script>alert(1)</script>", "qps": "20"}
+	r.Warnings = []string{"CPU usage up to 95% of GOMAXPROCS"}
+	r.Exemplars = &hist.Exemplars{
+		Slowest: []hist.Exemplar{{Start: int64(time.Second), Latency: 7 * time.Millisecond, Target: "a:80", Request: "GET /<slow>"}},
+	}
+
+	var b bytes.Buffer
+	if err := r.WriteHTML(&b); err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	out := b.String()
+	for _, s := range []string{
+		"<title>Test &lt;run&gt;</title>",
+		"<th>Requests</th><td class=\"num\">100</td>",
+		"<td>timeout</td><td class=\"num\">10</td><td class=\"num\">10.00</td>",
+		"timed out &lt;slowly&gt;",
+		"&lt;script&gt;alert(1)&lt;/script&gt;",
+		"Latency distribution",
+		"p99.99",
+		"<th>Max overage</th><td class=\"num\">99ms</td>",
+		"<h2>Slowest requests</h2>",
+		"<li>CPU usage up to 95% of GOMAXPROCS</li>",
+		"<td class=\"num\">1.000 s</td><td class=\"num\">7.000 ms</td><td>a:80</td><td class=\"examples\">GET /&lt;slow&gt;</td>",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("Expected %q in the report", s)
+		}
+	}
+	if n := strings.Count(out, "<svg"); n != 4 {
+		t.Errorf("Expected 4 charts, got %d", n)
+	}
+	if strings.Contains(out, "<script") || strings.Contains(out, "src=") || strings.Contains(out, "<link") {
+		t.Errorf("Expected a self-contained report without scripts or external resources")
+	}
+	if strings.Contains(out, "<h2>Host</h2>") {
+		t.Errorf("Expected no host section in a report replayed from an event log")
+	}
+
+	r.Host = CurrentHost()
+	b.Reset()
+	if err := r.WriteHTML(&b); err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	if !strings.Contains(b.String(), "<h2>Host</h2>") {
+		t.Errorf("Expected a host section in the report")
+	}
+}
+
+func TestWriteHTMLEmpty(t *testing.T) {
+	r := New("empty", bender.NewWindowedStats(time.Second, nil))
+	if err := r.WriteHTML(&bytes.Buffer{}); err == nil {
+		t.Errorf("Expected an error for a report without windows")
+	}
+	if _, err := FromEventLog("zero", testEventLog(), 0, nil); err == nil {
+		t.Errorf("Expected an error for a zero window width")
+	}
+}
+
+func TestNiceTicks(t *testing.T) {
+	for _, tc := range []struct {
+		min, max float64
+		n        int
+		ticks    []string
+	}{
+		{0, 9.5, 5, []string{"0", "2", "4", "6", "8", "10"}},
+		{0, 100, 5, []string{"0", "20", "40", "60", "80", "100"}},
+		{0, 0, 5, []string{"0", "0.2", "0.4", "0.6", "0.8", "1"}},
+		{3, 5, 4, []string{"3", "3.5", "4", "4.5", "5"}},
+	} {
+		var ticks []string
+		for _, v := range niceTicks(tc.min, tc.max, tc.n) {
+			ticks = append(ticks, formatTick(v))
+		}
+		if !reflect.DeepEqual(ticks, tc.ticks) {
+			t.Errorf("niceTicks(%v, %v, %d) = %v, want %v", tc.min, tc.max, tc.n, ticks, tc.ticks)
+		}
+	}
+}
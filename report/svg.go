@@ -0,0 +1,190 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The size of the charts, and the margins around the plot area for the axes and legend.
+const (
+	chartWidth   = 760
+	chartHeight  = 280
+	marginLeft   = 70
+	marginRight  = 20
+	marginTop    = 30
+	marginBottom = 45
+)
+
+// colors are the colors of the series in a chart, in order.
+var colors = []string{"#1f77b4", "#ff7f0e", "#d62728", "#2ca02c", "#9467bd", "#8c564b"}
+
+type point struct {
+	x, y float64
+}
+
+type series struct {
+	name   string
+	points []point
+}
+
+type tick struct {
+	v     float64
+	label string
+}
+
+// lineChart is a line chart with one or more series, drawn as an inline SVG image.
+type lineChart struct {
+	title, xLabel, yLabel string
+	series                []series
+	// The ticks on the x axis, which are computed from the range of the points if not set.
+	xTicks []tick
+}
+
+// niceTicks returns about n evenly spaced ticks from 0 or min to at least max, at multiples of 1, 2
+// or 5 times a power of ten.
+func niceTicks(min, max float64, n int) []float64 {
+	if max <= min {
+		max = min + 1
+	}
+	step := math.Pow(10, math.Floor(math.Log10((max-min)/float64(n))))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if (max-min)/(step*m) <= float64(n) {
+			step *= m
+			break
+		}
+	}
+	var ticks []float64
+	for i := math.Floor(min / step); ; i++ {
+		ticks = append(ticks, i*step)
+		if i*step >= max {
+			break
+		}
+	}
+	return ticks
+}
+
+// formatTick formats a tick value, rounded to hide floating point errors like 0.6000000000000001.
+func formatTick(v float64) string {
+	v, _ = strconv.ParseFloat(strconv.FormatFloat(v, 'g', 10, 64), 64)
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func (c *lineChart) svg() template.HTML {
+	xmin, xmax, ymax := math.Inf(1), math.Inf(-1), 0.0
+	for _, s := range c.series {
+		for _, p := range s.points {
+			xmin, xmax, ymax = math.Min(xmin, p.x), math.Max(xmax, p.x), math.Max(ymax, p.y)
+		}
+	}
+	xTicks := c.xTicks
+	if xTicks == nil {
+		if math.IsInf(xmin, 1) {
+			xmin, xmax = 0, 1
+		}
+		for _, v := range niceTicks(xmin, xmax, 8) {
+			xTicks = append(xTicks, tick{v, formatTick(v)})
+		}
+	}
+	xmin, xmax = xTicks[0].v, xTicks[len(xTicks)-1].v
+	if xmax <= xmin {
+		xmax = xmin + 1
+	}
+	yTicks := niceTicks(0, ymax, 5)
+	ymax = yTicks[len(yTicks)-1]
+
+	plotWidth := float64(chartWidth - marginLeft - marginRight)
+	plotHeight := float64(chartHeight - marginTop - marginBottom)
+	px := func(x float64) float64 { return marginLeft + (x-xmin)/(xmax-xmin)*plotWidth }
+	py := func(y float64) float64 { return marginTop + plotHeight - y/ymax*plotHeight }
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(&b, `<text x="%d" y="18" class="title">%s</text>`, marginLeft, template.HTMLEscapeString(c.title))
+	for _, v := range yTicks {
+		y := py(v)
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" class="grid"/>`, marginLeft, y, chartWidth-marginRight, y)
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" class="ytick">%s</text>`, marginLeft-6, y+4, formatTick(v))
+	}
+	for _, t := range xTicks {
+		x := px(t.v)
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" class="axis"/>`, x, chartHeight-marginBottom, x, chartHeight-marginBottom+4)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" class="xtick">%s</text>`, x, chartHeight-marginBottom+17, template.HTMLEscapeString(t.label))
+	}
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" class="axis"/>`, marginLeft, chartHeight-marginBottom, chartWidth-marginRight, chartHeight-marginBottom)
+	fmt.Fprintf(&b, `<text x="%.1f" y="%d" class="xlabel">%s</text>`, marginLeft+plotWidth/2, chartHeight-8, template.HTMLEscapeString(c.xLabel))
+	fmt.Fprintf(&b, `<text x="14" y="%.1f" class="ylabel" transform="rotate(-90 14 %.1f)">%s</text>`,
+		marginTop+plotHeight/2, marginTop+plotHeight/2, template.HTMLEscapeString(c.yLabel))
+
+	for i, s := range c.series {
+		color := colors[i%len(colors)]
+		var path strings.Builder
+		for j, p := range s.points {
+			cmd := "L"
+			if j == 0 {
+				cmd = "M"
+			}
+			fmt.Fprintf(&path, "%s%.1f %.1f ", cmd, px(p.x), py(p.y))
+		}
+		if len(s.points) == 1 {
+			fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="2" fill="%s"/>`, px(s.points[0].x), py(s.points[0].y), color)
+		} else if len(s.points) > 1 {
+			fmt.Fprintf(&b, `<path d="%s" stroke="%s" class="line"/>`, strings.TrimSpace(path.String()), color)
+		}
+		lx := chartWidth - marginRight - 100*(len(c.series)-i)
+		fmt.Fprintf(&b, `<rect x="%d" y="8" width="10" height="10" fill="%s"/>`, lx, color)
+		fmt.Fprintf(&b, `<text x="%d" y="17" class="legend">%s</text>`, lx+14, template.HTMLEscapeString(s.name))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// barChart is a horizontal bar chart, drawn as an inline SVG image.
+type barChart struct {
+	labels []string
+	values []float64
+}
+
+func (c *barChart) svg() template.HTML {
+	const barHeight, labelWidth, valueWidth = 22, 180, 80
+	max := 0.0
+	for _, v := range c.values {
+		max = math.Max(max, v)
+	}
+	height := barHeight*len(c.values) + 4
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		chartWidth, height, chartWidth, height)
+	for i, v := range c.values {
+		y := i*barHeight + 2
+		w := 0.0
+		if max > 0 {
+			w = v / max * float64(chartWidth-labelWidth-valueWidth)
+		}
+		fmt.Fprintf(&b, `<text x="%d" y="%d" class="ytick">%s</text>`, labelWidth-6, y+15, template.HTMLEscapeString(c.labels[i]))
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%.1f" height="%d" fill="%s"/>`, labelWidth, y+2, w, barHeight-6, colors[2])
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" class="legend">%s</text>`, float64(labelWidth)+w+6, y+15, formatTick(v))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
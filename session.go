@@ -0,0 +1,162 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bender
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Session holds the state shared by the steps of a single run through a scripted user journey,
+// such as auth tokens, cookies and IDs taken from earlier responses. A Session is only ever used
+// by one goroutine at a time, so it needs no locking.
+type Session struct {
+	// Vars holds named values set by earlier steps for use by later ones.
+	Vars map[string]interface{}
+}
+
+// NewSession creates an empty Session.
+func NewSession() *Session {
+	return &Session{Vars: make(map[string]interface{})}
+}
+
+// Get returns the value of the named variable, or nil if it hasn't been set.
+func (s *Session) Get(name string) interface{} {
+	return s.Vars[name]
+}
+
+// Set sets the value of the named variable.
+func (s *Session) Set(name string, value interface{}) {
+	s.Vars[name] = value
+}
+
+// Expand replaces ${name} or $name in the string with the value of the named session variable, so
+// that requests can refer to values extracted from earlier responses. Unset variables are replaced
+// with the empty string.
+func (s *Session) Expand(str string) string {
+	return os.Expand(str, func(name string) string {
+		v, ok := s.Vars[name]
+		if !ok {
+			return ""
+		}
+		return fmt.Sprint(v)
+	})
+}
+
+// An Extractor pulls a single value out of a response, so that it can be saved in a Session and used
+// by later requests. The protocol packages provide extractors for their response types.
+type Extractor func(response interface{}) (interface{}, error)
+
+// SessionStep is one request in a scripted session.
+type SessionStep struct {
+	// The name of the step, which is used to identify it in events and errors.
+	Name string
+	// Request creates the request for this step, typically using values from the session.
+	Request func(s *Session) (interface{}, error)
+	// Exec sends the request and returns the response.
+	Exec RequestExecutor
+	// Extract maps session variable names to the extractors whose values are saved under those
+	// names after the step's request succeeds. It is optional.
+	Extract map[string]Extractor
+	// Response is called with the response to the step's request, after the values in Extract have
+	// been saved, and can be used to save other values in the session for later steps. It is
+	// optional.
+	Response func(s *Session, response interface{}) error
+	// Think generates the time (in nanoseconds) to wait after this step before starting the next
+	// one. It is optional, and is not called after the last step.
+	Think IntervalGenerator
+}
+
+// StartStepEvent is sent before each step of a session is executed.
+type StartStepEvent struct {
+	// The Unix epoch time (in nanoseconds) at which this event was created.
+	Time int64
+	// The name of the step.
+	Step string
+	// The request that will be sent by the step.
+	Request interface{}
+}
+
+// EndStepEvent is sent after each step of a session has completed.
+type EndStepEvent struct {
+	// The Unix epoch times (in nanoseconds) at which the step was started and finished.
+	Start, End int64
+	// The name of the step.
+	Step string
+	// The response data returned by the step's request executor
+	Response interface{}
+	// An error or nil if there was no error
+	Err error
+	// The tags of the step's request, if its request executor returned a TaggedResponse.
+	Tags map[string]string
+}
+
+// NewSessionExecutor creates a RequestExecutor that runs each of the given steps in order, as a
+// single transaction. The request passed to the executor must be a *Session, and is used to share
+// state between the steps. The StartStepEvent and EndStepEvent messages for each step are sent to
+// the recorder channel, and the load tester sends the usual EndRequestEvent for the whole session,
+// so the transaction latency (including think times) is recorded alongside the per-step latency.
+// The session stops at the first step that returns an error, and that error is returned. The
+// response of the last step is returned, unwrapped if it's a TaggedResponse, so the tags of each step
+// are only sent in its EndStepEvent, and the session's latency isn't counted under the tags of its
+// last step.
+func NewSessionExecutor(recorder chan interface{}, steps ...SessionStep) RequestExecutor {
+	return func(_ int64, request interface{}) (interface{}, error) {
+		s, ok := request.(*Session)
+		if !ok {
+			return nil, fmt.Errorf("invalid request type %T, want: *bender.Session", request)
+		}
+
+		var res interface{}
+		for i, step := range steps {
+			req, err := step.Request(s)
+			if err != nil {
+				return nil, fmt.Errorf("step %q: %w", step.Name, err)
+			}
+
+			recorder <- &StartStepEvent{time.Now().UnixNano(), step.Name, req}
+			stepStart := time.Now().UnixNano()
+			tagged, err := step.Exec(stepStart, req)
+			var tags map[string]string
+			res, tags = untagResponse(tagged)
+			recorder <- &EndStepEvent{Start: stepStart, End: time.Now().UnixNano(), Step: step.Name, Response: res, Err: err, Tags: tags}
+			if err != nil {
+				return res, fmt.Errorf("step %q: %w", step.Name, err)
+			}
+
+			for name, extract := range step.Extract {
+				v, err := extract(res)
+				if err != nil {
+					return nil, fmt.Errorf("step %q: extracting %s: %w", step.Name, name, err)
+				}
+				s.Set(name, v)
+			}
+
+			if step.Response != nil {
+				if err := step.Response(s, res); err != nil {
+					return nil, fmt.Errorf("step %q: %w", step.Name, err)
+				}
+			}
+
+			if step.Think != nil && i < len(steps)-1 {
+				time.Sleep(time.Duration(step.Think(time.Now().UnixNano())))
+			}
+		}
+		return res, nil
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bender
+
+import (
+	"errors"
+	"testing"
+)
+
+func echoExec(_ int64, request interface{}) (interface{}, error) {
+	return request, nil
+}
+
+func TestSessionExecutorSharesState(t *testing.T) {
+	cr := make(chan interface{}, 10)
+	exec := NewSessionExecutor(cr,
+		SessionStep{
+			Name:    "login",
+			Request: func(*Session) (interface{}, error) { return "token", nil },
+			Exec:    echoExec,
+			Response: func(s *Session, res interface{}) error {
+				s.Set("token", res)
+				return nil
+			},
+		},
+		SessionStep{
+			Name:    "feed",
+			Request: func(s *Session) (interface{}, error) { return s.Get("token"), nil },
+			Exec:    echoExec,
+		})
+
+	res, err := exec(0, NewSession())
+	if err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	if res != "token" {
+		t.Errorf("Expected the last step to see the saved token, got (%v)", res)
+	}
+	close(cr)
+	assertMessages(t, cr, &StartStepEvent{}, &EndStepEvent{}, &StartStepEvent{}, &EndStepEvent{})
+}
+
+func TestSessionExecutorStopsOnError(t *testing.T) {
+	cr := make(chan interface{}, 10)
+	exec := NewSessionExecutor(cr,
+		SessionStep{
+			Name:    "login",
+			Request: func(*Session) (interface{}, error) { return nil, nil },
+			Exec:    errorExec,
+		},
+		SessionStep{
+			Name:    "feed",
+			Request: func(*Session) (interface{}, error) { return nil, errors.New("not reached") },
+			Exec:    noOpExec,
+		})
+
+	_, err := exec(0, NewSession())
+	if err == nil || err.Error() != `step "login": fake error` {
+		t.Errorf("Expected the session to fail in the first step, got (%v)", err)
+	}
+	close(cr)
+	assertMessages(t, cr, &StartStepEvent{}, &EndStepEvent{})
+	if _, ok := <-cr; ok {
+		t.Error("Expected no events after the failed step")
+	}
+}
+
+func TestSessionExecutorTypeCheck(t *testing.T) {
+	exec := NewSessionExecutor(make(chan interface{}))
+	_, err := exec(0, 42)
+	if err == nil || err.Error() != "invalid request type int, want: *bender.Session" {
+		t.Errorf("Expected executor to fail with invalid request type error, got (%v)", err)
+	}
+}
+
+func TestSessionExecutorExtract(t *testing.T) {
+	exec := NewSessionExecutor(make(chan interface{}, 10),
+		SessionStep{
+			Name:    "create",
+			Request: func(*Session) (interface{}, error) { return 42, nil },
+			Exec:    echoExec,
+			Extract: map[string]Extractor{
+				"id": func(res interface{}) (interface{}, error) { return res, nil },
+			},
+		},
+		SessionStep{
+			Name:    "read",
+			Request: func(s *Session) (interface{}, error) { return s.Expand("/items/${id}"), nil },
+			Exec:    echoExec,
+		})
+
+	res, err := exec(0, NewSession())
+	if err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	if res != "/items/42" {
+		t.Errorf("Expected the extracted id in the request, got (%v)", res)
+	}
+}
+
+func TestSessionExecutorExtractError(t *testing.T) {
+	exec := NewSessionExecutor(make(chan interface{}, 10),
+		SessionStep{
+			Name:    "create",
+			Request: func(*Session) (interface{}, error) { return nil, nil },
+			Exec:    noOpExec,
+			Extract: map[string]Extractor{
+				"id": func(interface{}) (interface{}, error) { return nil, errors.New("no id") },
+			},
+		})
+
+	_, err := exec(0, NewSession())
+	if err == nil || err.Error() != `step "create": extracting id: no id` {
+		t.Errorf("Expected the session to fail extracting the id, got (%v)", err)
+	}
+}
+
+func TestSessionExecutorTags(t *testing.T) {
+	cr := make(chan interface{}, 10)
+	exec := NewSessionExecutor(cr,
+		SessionStep{
+			Name:    "feed",
+			Request: func(*Session) (interface{}, error) { return "feed", nil },
+			Exec:    TagExecutor(echoExec, map[string]string{TagRoute: "/feed"}),
+		})
+
+	res, err := exec(0, NewSession())
+	if err != nil || res != "feed" {
+		t.Fatalf("Expected the untagged response of the last step, got (%v, %v)", res, err)
+	}
+	<-cr
+	if end := (<-cr).(*EndStepEvent); end.Tags[TagRoute] != "/feed" {
+		t.Errorf("Expected the step's tags in its EndStepEvent, got %v", end.Tags)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package slo
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pinterest/bender"
+)
+
+// Monitor checks assertions while a load test runs, and reports the first assertion that can no
+// longer be met, whatever the rest of the load test does, so that a failing load test can be stopped
+// early. Its Record method is a Recorder, and the Failed channel is closed when an assertion fails:
+//
+//	m := slo.NewMonitor(assertions, n)
+//	go func() {
+//		<-m.Failed()
+//		close(stop) // Stop sending requests.
+//	}()
+//	bender.Record(recorder, m.Record, bender.NewHistogramRecorder(h))
+//
+// Only upper bounds (< and <=) on latencies, overage and the error rate can fail early.
+type Monitor struct {
+	assertions []*Assertion
+	total      int
+	errors     int
+	// The number of successful requests that don't meet each percentile assertion's threshold.
+	slow []int
+
+	mu      sync.Mutex
+	failure *Result
+	failed  chan struct{}
+}
+
+// NewMonitor creates a Monitor for a load test that sends the given total number of requests.
+// Latency percentile and error rate assertions can only fail early if the total is known, and are
+// ignored if it is zero. Maximum latency and overage assertions fail as soon as they are exceeded.
+func NewMonitor(assertions []*Assertion, total int) *Monitor {
+	return &Monitor{
+		assertions: assertions,
+		total:      total,
+		slow:       make([]int, len(assertions)),
+		failed:     make(chan struct{}),
+	}
+}
+
+// Failed returns a channel that is closed when an assertion can no longer be met.
+func (m *Monitor) Failed() <-chan struct{} {
+	return m.failed
+}
+
+// Failure returns the result of the first assertion that failed, or nil if none has.
+func (m *Monitor) Failure() *Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.failure
+}
+
+func (m *Monitor) fail(a *Assertion, actual float64, format string, args ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failure != nil {
+		return
+	}
+	m.failure = &Result{Assertion: a.Expr, Actual: actual, Threshold: a.threshold, Message: fmt.Sprintf(format, args...)}
+	close(m.failed)
+}
+
+// Record checks the assertions against an event.
+func (m *Monitor) Record(msg interface{}) {
+	if m.Failure() != nil {
+		return
+	}
+	if e, ok := msg.(*bender.EndRequestEvent); ok && e.Err != nil {
+		m.errors++
+	}
+	for i, a := range m.assertions {
+		if a.op != "<" && a.op != "<=" {
+			continue
+		}
+		switch msg := msg.(type) {
+		case *bender.WaitEvent:
+			if a.metric == metricOverage && !a.holds(float64(msg.Overage), a.threshold) {
+				m.fail(a, float64(msg.Overage), "%s = %s, want %s %s", a.name, a.format(float64(msg.Overage)), a.op, a.format(a.threshold))
+			}
+		case *bender.EndRequestEvent:
+			elapsed := float64(msg.End - msg.Start)
+			switch {
+			case msg.Err != nil && a.metric == metricErrorPercent && m.total > 0:
+				if pct := float64(m.errors) / float64(m.total) * 100; !a.holds(pct, a.threshold) {
+					m.fail(a, pct, "%s is already %s with %d errors of %d requests, want %s %s",
+						a.name, a.format(pct), m.errors, m.total, a.op, a.format(a.threshold))
+				}
+			case msg.Err == nil && a.metric == metricMax && !a.holds(elapsed, a.threshold):
+				m.fail(a, elapsed, "%s = %s, want %s %s", a.name, a.format(elapsed), a.op, a.format(a.threshold))
+			case msg.Err == nil && a.metric == metricPercentile && m.total > 0 && !a.holds(elapsed, a.threshold):
+				m.slow[i]++
+				// Fail once too few requests are left to bring the percentile under the threshold.
+				if float64(m.total-m.slow[i]) < a.percentile*float64(m.total)-1e-9 {
+					m.fail(a, elapsed, "%s can no longer be %s %s: %d of %d requests are slower",
+						a.name, a.op, a.format(a.threshold), m.slow[i], m.total)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,298 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package slo checks the results of a load test against declarative assertions, like "p99 < 250ms"
+// or "error% < 0.1", so that load tests can gate a CI pipeline. The results can be written as JUnit
+// XML, which most CI systems can display, or as JSON, and a Monitor can abort a running load test as
+// soon as an assertion can no longer be met.
+package slo
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pinterest/bender"
+	"github.com/pinterest/bender/hist"
+)
+
+// The metrics that assertions can check.
+const (
+	// A latency percentile, like p99.
+	metricPercentile = "percentile"
+	// The mean and largest latency.
+	metricMean = "mean"
+	metricMax  = "max"
+	// The percentage of requests that failed.
+	metricErrorPercent = "error%"
+	// The achieved throughput.
+	metricQPS = "qps"
+	// The largest overage of the load test.
+	metricOverage = "max overage"
+)
+
+// metricNames maps the accepted names of each metric to the metric.
+var metricNames = map[string]string{
+	"mean":         metricMean,
+	"max":          metricMax,
+	"error%":       metricErrorPercent,
+	"errors%":      metricErrorPercent,
+	"error rate":   metricErrorPercent,
+	"qps":          metricQPS,
+	"achieved qps": metricQPS,
+	"throughput":   metricQPS,
+	"overage":      metricOverage,
+	"max overage":  metricOverage,
+}
+
+var (
+	assertionRegexp  = regexp.MustCompile(`^\s*(.+?)\s*(<=|>=|<|>)\s*(.+?)\s*$`)
+	percentileRegexp = regexp.MustCompile(`^p(\d+(?:\.\d+)?)$`)
+	ofTargetRegexp   = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*%\s+of\s+target$`)
+)
+
+// Assertion is a condition on a statistic of a load test, like "p99 < 250ms".
+type Assertion struct {
+	// The assertion as it was written.
+	Expr string
+	// The metric checked by the assertion as it was written, the metric, and the percentile for
+	// latency percentiles.
+	name       string
+	metric     string
+	percentile float64
+	// The comparison operator, and the threshold the metric is compared to. Latencies are in
+	// nanoseconds, error rates in percent and throughput in requests per second, or as a fraction of
+	// the target throughput if ofTarget is set.
+	op        string
+	threshold float64
+	ofTarget  bool
+}
+
+// Parse parses an assertion of the form "<metric> <op> <value>", where op is <, <=, > or >=. The
+// metrics are:
+//
+//	p50, p99, p99.9, ...  a latency percentile, like "p99 < 250ms"
+//	mean, max             the mean or largest latency, like "max < 2s"
+//	error%                the percentage of failed requests, like "error% < 0.1"
+//	qps                   the achieved throughput, in requests per second or as a percentage of
+//	                      the target, like "qps >= 95% of target"
+//	max overage           the largest overage, like "max overage < 1s"
+//
+// Latencies and overages are durations, as parsed by time.ParseDuration.
+func Parse(expr string) (*Assertion, error) {
+	m := assertionRegexp.FindStringSubmatch(expr)
+	if m == nil {
+		return nil, fmt.Errorf("invalid assertion %q, want: <metric> <op> <value>", expr)
+	}
+	a := &Assertion{Expr: strings.TrimSpace(expr), name: m[1], op: m[2]}
+	name := strings.Join(strings.Fields(strings.ToLower(m[1])), " ")
+	value := m[3]
+
+	if pm := percentileRegexp.FindStringSubmatch(name); pm != nil {
+		p, _ := strconv.ParseFloat(pm[1], 64)
+		if p > 100 {
+			return nil, fmt.Errorf("invalid percentile in assertion %q", expr)
+		}
+		a.metric, a.percentile = metricPercentile, p/100
+	} else if a.metric = metricNames[name]; a.metric == "" {
+		return nil, fmt.Errorf("unknown metric %q in assertion %q", m[1], expr)
+	}
+
+	var err error
+	switch a.metric {
+	case metricPercentile, metricMean, metricMax, metricOverage:
+		var d time.Duration
+		d, err = time.ParseDuration(value)
+		a.threshold = float64(d)
+	case metricErrorPercent:
+		a.threshold, err = strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(value, "%")), 64)
+	case metricQPS:
+		if tm := ofTargetRegexp.FindStringSubmatch(strings.ToLower(value)); tm != nil {
+			a.threshold, err = strconv.ParseFloat(tm[1], 64)
+			a.threshold /= 100
+			a.ofTarget = true
+		} else {
+			a.threshold, err = strconv.ParseFloat(value, 64)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid value in assertion %q: %w", expr, err)
+	}
+	return a, nil
+}
+
+// ParseAll parses each of the assertions, and returns the first error, if any.
+func ParseAll(exprs ...string) ([]*Assertion, error) {
+	assertions := make([]*Assertion, len(exprs))
+	for i, expr := range exprs {
+		a, err := Parse(expr)
+		if err != nil {
+			return nil, err
+		}
+		assertions[i] = a
+	}
+	return assertions, nil
+}
+
+func (a *Assertion) String() string {
+	return a.Expr
+}
+
+// holds returns true if the actual value satisfies the assertion's comparison with the threshold.
+func (a *Assertion) holds(actual, threshold float64) bool {
+	switch a.op {
+	case "<":
+		return actual < threshold
+	case "<=":
+		return actual <= threshold
+	case ">":
+		return actual > threshold
+	}
+	return actual >= threshold
+}
+
+// isLatency returns true if the assertion's metric is a duration.
+func (a *Assertion) isLatency() bool {
+	return a.metric == metricPercentile || a.metric == metricMean || a.metric == metricMax || a.metric == metricOverage
+}
+
+// format formats a value of the assertion's metric.
+func (a *Assertion) format(v float64) string {
+	switch {
+	case a.isLatency():
+		return time.Duration(v).Round(time.Microsecond).String()
+	case a.metric == metricErrorPercent:
+		return strconv.FormatFloat(v, 'f', 2, 64) + "%"
+	}
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// Stats are the statistics of a load test that assertions are evaluated against.
+type Stats struct {
+	// The histogram of the whole load test. If it is nil, it is merged from the windowed stats.
+	Hist *hist.Histogram
+	// The windowed stats of the load test, which are needed for overage assertions.
+	Windows *bender.WindowedStats
+	// The target throughput of the load test, which is needed for throughput assertions relative to
+	// the target.
+	TargetQPS float64
+}
+
+// Result is the result of evaluating an assertion.
+type Result struct {
+	Assertion string `json:"assertion"`
+	Passed    bool   `json:"passed"`
+	// The actual value of the metric, and the threshold it was compared to, in nanoseconds for
+	// latencies, percent for error rates and requests per second for throughput.
+	Actual    float64 `json:"actual"`
+	Threshold float64 `json:"threshold"`
+	// A description of the result, like "p99 = 312ms, want < 250ms".
+	Message string `json:"message"`
+}
+
+// Evaluate evaluates the assertion against the statistics of a load test. Latency assertions are
+// evaluated against the latencies of successful requests only, since fast errors would otherwise
+// make a failing service look fast.
+func (a *Assertion) Evaluate(s *Stats) Result {
+	r := Result{Assertion: a.Expr, Threshold: a.threshold}
+	fail := func(format string, args ...interface{}) Result {
+		r.Message = fmt.Sprintf(format, args...)
+		return r
+	}
+
+	h := s.Hist
+	if h == nil && s.Windows != nil {
+		var err error
+		if h, err = s.Windows.Total(); err != nil {
+			return fail("no statistics: %v", err)
+		}
+	}
+	if h == nil {
+		return fail("no statistics")
+	}
+	scale := float64(h.Scale())
+	ok := h.Successes()
+
+	switch a.metric {
+	case metricPercentile:
+		if ok.Count() == 0 {
+			return fail("no successful requests")
+		}
+		r.Actual = ok.InterpolatedPercentiles(a.percentile)[0] * scale
+	case metricMean:
+		if ok.Count() == 0 {
+			return fail("no successful requests")
+		}
+		r.Actual = ok.Average() * scale
+	case metricMax:
+		r.Actual = ok.Max() * scale
+	case metricErrorPercent:
+		if h.Count() > 0 {
+			r.Actual = h.ErrorPercent()
+		}
+	case metricQPS:
+		r.Actual = h.Summary().QPS
+		if a.ofTarget {
+			if s.TargetQPS <= 0 {
+				return fail("no target throughput")
+			}
+			r.Threshold = a.threshold * s.TargetQPS
+		}
+	case metricOverage:
+		if s.Windows == nil {
+			return fail("no windowed stats")
+		}
+		for _, w := range s.Windows.Windows {
+			if float64(w.MaxOverage) > r.Actual {
+				r.Actual = float64(w.MaxOverage)
+			}
+		}
+	}
+
+	r.Passed = a.holds(r.Actual, r.Threshold)
+	r.Message = fmt.Sprintf("%s = %s, want %s %s", a.name, a.format(r.Actual), a.op, a.format(r.Threshold))
+	return r
+}
+
+// Report holds the results of evaluating a set of assertions.
+type Report struct {
+	Passed  bool     `json:"passed"`
+	Results []Result `json:"results"`
+}
+
+// Evaluate evaluates each of the assertions against the statistics of a load test.
+func Evaluate(assertions []*Assertion, s *Stats) *Report {
+	r := &Report{Passed: true}
+	for _, a := range assertions {
+		res := a.Evaluate(s)
+		r.Passed = r.Passed && res.Passed
+		r.Results = append(r.Results, res)
+	}
+	return r
+}
+
+// Failures returns the results of the assertions that failed.
+func (r *Report) Failures() []Result {
+	var failures []Result
+	for _, res := range r.Results {
+		if !res.Passed {
+			failures = append(failures, res)
+		}
+	}
+	return failures
+}
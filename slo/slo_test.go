@@ -0,0 +1,186 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package slo
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pinterest/bender"
+	"github.com/pinterest/bender/hist"
+)
+
+// testStats returns the stats of a 10 second load test of 1000 requests, with latencies from 1ms to
+// 100ms, 5 errors and an overage of up to 500ms.
+func testStats() *Stats {
+	ws := bender.NewWindowedStats(time.Second, func() *hist.Histogram {
+		return hist.NewLogHistogram(3, int(time.Microsecond))
+	})
+	r := bender.NewWindowedRecorder(ws)
+	ms := int64(time.Millisecond)
+	r(&bender.StartEvent{Start: 0})
+	for i := int64(0); i < 1000; i++ {
+		var err error
+		if i%200 == 0 {
+			err = bender.TagError(bender.ErrorClassServer, errors.New("500"))
+		}
+		r(&bender.WaitEvent{Overage: i / 2 * ms, Time: i * 10 * ms})
+		r(&bender.EndRequestEvent{Start: i * 10 * ms, End: i*10*ms + (i%100+1)*ms, Err: err})
+	}
+	r(&bender.EndEvent{Start: 0, End: 10 * int64(time.Second)})
+	return &Stats{Windows: ws, TargetQPS: 100}
+}
+
+func TestParse(t *testing.T) {
+	for _, expr := range []string{"p99 < 250ms", "P99.9<=1s", "error% < 0.1", "error rate < 0.1%",
+		"qps >= 95% of target", "achieved QPS > 50", "max overage < 1s", "mean < 10ms", "max <= 2s"} {
+		if _, err := Parse(expr); err != nil {
+			t.Errorf("Parse(%q): Expected no error, got (%v)", expr, err)
+		}
+	}
+	for _, expr := range []string{"p99", "p99 < fast", "p101 < 1s", "latency < 1s", "qps > 95% of max", "error% < x"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q): Expected an error", expr)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	for _, tc := range []struct {
+		expr    string
+		passed  bool
+		message string
+	}{
+		{"p50 < 60ms", true, "p50 = 50.982ms, want < 60ms"},
+		{"p99 < 50ms", false, "p99 = 99.968ms, want < 50ms"},
+		{"max <= 100ms", true, "max = 100ms, want <= 100ms"},
+		{"error% < 0.1", false, "error% = 0.50%, want < 0.10%"},
+		{"error% < 1%", true, "error% = 0.50%, want < 1.00%"},
+		{"qps >= 95% of target", true, "qps = 100.00, want >= 95.00"},
+		{"qps > 120", false, "qps = 100.00, want > 120.00"},
+		{"max overage < 1s", true, "max overage = 499ms, want < 1s"},
+		{"max overage < 100ms", false, "max overage = 499ms, want < 100ms"},
+	} {
+		a, err := Parse(tc.expr)
+		if err != nil {
+			t.Fatalf("Expected no error, got (%v)", err)
+		}
+		r := a.Evaluate(testStats())
+		if r.Passed != tc.passed || r.Message != tc.message {
+			t.Errorf("%s: Expected passed=%t %q, got passed=%t %q", tc.expr, tc.passed, tc.message, r.Passed, r.Message)
+		}
+	}
+
+	a, _ := Parse("max overage < 1s")
+	if r := a.Evaluate(&Stats{Hist: hist.NewHistogram(10, 1)}); r.Passed || r.Message != "no windowed stats" {
+		t.Errorf("Expected an overage assertion without windowed stats to fail, got %+v", r)
+	}
+}
+
+func TestReportOutput(t *testing.T) {
+	assertions, err := ParseAll("p99 < 250ms", "error% < 0.1")
+	if err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	r := Evaluate(assertions, testStats())
+	if r.Passed || len(r.Failures()) != 1 {
+		t.Fatalf("Expected one failure, got %+v", r)
+	}
+
+	var b bytes.Buffer
+	if err := r.WriteJUnit(&b, "bender"); err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	var suites junitTestSuites
+	if err := xml.Unmarshal(b.Bytes(), &suites); err != nil {
+		t.Fatalf("Expected valid XML, got (%v)\n%s", err, b.String())
+	}
+	s := suites.Suites[0]
+	if s.Tests != 2 || s.Failures != 1 || s.Cases[0].Failure != nil || s.Cases[1].Failure == nil ||
+		s.Cases[1].Name != "error% < 0.1" {
+		t.Errorf("Unexpected JUnit XML\n%s", b.String())
+	}
+
+	b.Reset()
+	if err := r.WriteJSON(&b); err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(b.Bytes(), &decoded); err != nil || decoded.Passed || len(decoded.Results) != 2 {
+		t.Errorf("Unexpected JSON summary\n%s", b.String())
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	ms := int64(time.Millisecond)
+	for _, tc := range []struct {
+		expr   string
+		events []interface{}
+		failAt int
+	}{
+		{"max overage < 1s", []interface{}{
+			&bender.WaitEvent{Overage: 500 * ms},
+			&bender.WaitEvent{Overage: 1500 * ms},
+		}, 1},
+		{"max < 10ms", []interface{}{
+			&bender.EndRequestEvent{Start: 0, End: 5 * ms},
+			&bender.EndRequestEvent{Start: 0, End: 50 * ms, Err: errors.New("slow error")},
+			&bender.EndRequestEvent{Start: 0, End: 50 * ms},
+		}, 2},
+		// With 10 requests, 1 error is 10%, and p80 fails once 3 requests are slow.
+		{"error% < 15", []interface{}{
+			&bender.EndRequestEvent{Err: errors.New("1")},
+			&bender.EndRequestEvent{Err: errors.New("2")},
+		}, 1},
+		{"p80 < 10ms", []interface{}{
+			&bender.EndRequestEvent{Start: 0, End: 50 * ms},
+			&bender.EndRequestEvent{Start: 0, End: 50 * ms},
+			&bender.EndRequestEvent{Start: 0, End: 5 * ms},
+			&bender.EndRequestEvent{Start: 0, End: 50 * ms},
+		}, 3},
+		// Lower bounds can't fail early.
+		{"qps > 1000", []interface{}{&bender.EndRequestEvent{}}, -1},
+	} {
+		a, err := Parse(tc.expr)
+		if err != nil {
+			t.Fatalf("Expected no error, got (%v)", err)
+		}
+		m := NewMonitor([]*Assertion{a}, 10)
+		failedAt := -1
+		for i, e := range tc.events {
+			m.Record(e)
+			select {
+			case <-m.Failed():
+				if failedAt < 0 {
+					failedAt = i
+				}
+			default:
+			}
+		}
+		if failedAt != tc.failAt {
+			t.Errorf("%s: Expected a failure at event %d, got %d (%+v)", tc.expr, tc.failAt, failedAt, m.Failure())
+		}
+		if tc.failAt >= 0 && !strings.HasPrefix(m.Failure().Message, strings.Fields(tc.expr)[0]) {
+			t.Errorf("%s: Unexpected message %q", tc.expr, m.Failure().Message)
+		}
+	}
+}
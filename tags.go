@@ -0,0 +1,82 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bender
+
+import "time"
+
+// The tag keys set by the protocol executors.
+const (
+	// The host (and port) that the request was sent to.
+	TagTarget = "target"
+	// The DNS query type, like "A" or "AAAA".
+	TagQType = "qtype"
+	// The HTTP method and route.
+	TagMethod = "method"
+	TagRoute  = "route"
+)
+
+// TaggedResponse is returned by request executors to describe how a request was handled, like the
+// host that served it and how long each phase of the request took, along with the response, which
+// may be nil if the request failed. The load tests unwrap it, so the EndRequestEvent has the inner
+// Response, and the tags and phases in its Tags and Phases fields.
+type TaggedResponse struct {
+	Response interface{}
+	Tags     map[string]string
+	Phases   map[string]time.Duration
+}
+
+// untagResponse returns the inner response and tags of a TaggedResponse, or the response itself and
+// nil tags for any other response.
+func untagResponse(res interface{}) (interface{}, map[string]string) {
+	if tr, ok := res.(*TaggedResponse); ok {
+		return tr.Response, tr.Tags
+	}
+	return res, nil
+}
+
+// UnwrapResponse returns the inner response of a TaggedResponse, or the response itself for any other
+// response. The load tests and session steps unwrap the responses of their executors, but code that
+// calls an executor directly, like the protocol executors, which return TaggedResponses, needs to
+// unwrap the response before asserting its type.
+func UnwrapResponse(res interface{}) interface{} {
+	res, _ = untagResponse(res)
+	return res
+}
+
+// TagResponse adds tags to a response, which is wrapped in a TaggedResponse unless it is one already.
+func TagResponse(res interface{}, tags map[string]string) *TaggedResponse {
+	tr, ok := res.(*TaggedResponse)
+	if !ok {
+		tr = &TaggedResponse{Response: res}
+	}
+	if tr.Tags == nil {
+		tr.Tags = make(map[string]string, len(tags))
+	}
+	for k, v := range tags {
+		tr.Tags[k] = v
+	}
+	return tr
+}
+
+// TagExecutor wraps a request executor to add the given tags, like the name of a scenario, to every
+// request it sends, along with any tags added by the executor itself.
+func TagExecutor(exec RequestExecutor, tags map[string]string) RequestExecutor {
+	return func(t int64, request interface{}) (interface{}, error) {
+		res, err := exec(t, request)
+		return TagResponse(res, tags), err
+	}
+}
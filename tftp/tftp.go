@@ -42,8 +42,13 @@ func CreateExecutor(client *tftp.Client, validator ResponseValidator) bender.Req
 		}
 		w, err := client.Receive(r.Filename, string(r.Mode))
 		if err != nil {
-			return nil, err
+			return nil, bender.TagNetworkError(err)
 		}
-		return validator(r, w)
+		// The validator reads the file, so it can fail with network errors as well as its own.
+		res, err := validator(r, w)
+		if bender.ClassifyError(err) == bender.ErrorClassOther {
+			return res, bender.TagError(bender.ErrorClassValidation, err)
+		}
+		return res, bender.TagNetworkError(err)
 	}
 }
@@ -19,33 +19,111 @@ package thrift
 import (
 	"bytes"
 	"context"
+	"errors"
 	"math/rand"
 
 	"github.com/apache/thrift/lib/go/thrift"
 	"github.com/pinterest/bender"
+	"github.com/pinterest/bender/trace"
 )
 
 // A ClientExecutor executes a Thrift request.
 type ClientExecutor func(interface{}, thrift.TTransport) (interface{}, error)
 
-// NewThriftRequestExec creates a new Thrift-based RequestExecutor.
+// TracedRequest is a request with a traceparent, which is returned by InjectTraceparent and passed
+// to the ClientExecutor as is.
+type TracedRequest struct {
+	Request     interface{}
+	Traceparent string
+}
+
+// InjectTraceparent is a trace.Injector for Thrift requests, which wraps the request in a
+// TracedRequest. ClientExecutors of traced requests must get the context of their call from
+// RequestContext, so that the traceparent is sent as a THeader header.
+func InjectTraceparent(request interface{}, traceparent string) (interface{}, error) {
+	return &TracedRequest{Request: request, Traceparent: traceparent}, nil
+}
+
+// RequestContext returns the context for the Thrift call of a request, and the request to send. For
+// a TracedRequest, the context carries its traceparent as a write header, which clients using the
+// THeader protocol send along with the call, and the request is the inner request. Other requests
+// are returned as is, with the parent context.
+func RequestContext(ctx context.Context, request interface{}) (context.Context, interface{}) {
+	tr, ok := request.(*TracedRequest)
+	if !ok {
+		return ctx, request
+	}
+	ctx = thrift.SetHeader(ctx, trace.Header, tr.Traceparent)
+	ctx = thrift.SetWriteHeaderList(ctx, append(thrift.GetWriteHeaderList(ctx), trace.Header))
+	return ctx, tr.Request
+}
+
+// NewThriftRequestExec creates a new Thrift-based RequestExecutor, which sends each request to a
+// random one of the hosts. Its responses are those of the ClientExecutor.
 func NewThriftRequestExec(tFac thrift.TTransportFactory, clientExec ClientExecutor, cfg *thrift.TConfiguration, hosts ...string) bender.RequestExecutor {
+	return newThriftRequestExec(tFac, clientExec, cfg, false, hosts)
+}
+
+// NewTaggedThriftRequestExec creates a Thrift-based RequestExecutor like NewThriftRequestExec, whose
+// responses are *bender.TaggedResponse values holding the response of the ClientExecutor, tagged
+// with the host (bender.TagTarget). Requests that fail to connect are tagged as well, with a nil
+// response. The load test unwraps the responses into the Tags of its EndRequestEvents, and code that
+// calls the executor directly gets the response with bender.UnwrapResponse.
+func NewTaggedThriftRequestExec(tFac thrift.TTransportFactory, clientExec ClientExecutor, cfg *thrift.TConfiguration, hosts ...string) bender.RequestExecutor {
+	return newThriftRequestExec(tFac, clientExec, cfg, true, hosts)
+}
+
+func newThriftRequestExec(tFac thrift.TTransportFactory, clientExec ClientExecutor, cfg *thrift.TConfiguration, tag bool, hosts []string) bender.RequestExecutor {
 	return func(_ int64, request interface{}) (interface{}, error) {
 		addr := hosts[rand.Intn(len(hosts))]
+		response := func(res interface{}) interface{} {
+			if tag {
+				return bender.TagResponse(res, map[string]string{bender.TagTarget: addr})
+			}
+			return res
+		}
 		socket := thrift.NewTSocketConf(addr, cfg)
 		defer socket.Close()
 
 		transport, err := tFac.GetTransport(socket)
 		if err != nil {
-			return nil, err
+			return response(nil), bender.TagNetworkError(err)
 		}
 		if err := transport.Open(); err != nil {
-			return nil, err
+			return response(nil), bender.TagNetworkError(err)
 		}
 		defer transport.Close()
 
-		return clientExec(request, transport)
+		res, err := clientExec(request, transport)
+		return response(res), tagError(err)
+	}
+}
+
+// tagError tags the errors returned by a ClientExecutor according to their Thrift exception type.
+// Other errors are returned unchanged, so ClientExecutors can tag their own. The exception interfaces
+// overlap (every TTransportException is also a TProtocolException, as far as errors.As can tell), so
+// the exceptions are told apart by their TExceptionType.
+func tagError(err error) error {
+	var ce *bender.ClassifiedError
+	var te thrift.TException
+	if err == nil || errors.As(err, &ce) || !errors.As(err, &te) {
+		return err
+	}
+	switch te.TExceptionType() {
+	case thrift.TExceptionTypeApplication:
+		return bender.TagError(bender.ErrorClassServer, err)
+	case thrift.TExceptionTypeProtocol:
+		return bender.TagError(bender.ErrorClassProtocol, err)
+	case thrift.TExceptionTypeTransport:
+		// Transport exceptions that don't wrap a known network error, like NOT_OPEN, are still
+		// network errors rather than protocol errors.
+		class := bender.ClassifyError(err)
+		if class == bender.ErrorClassOther {
+			class = bender.ErrorClassNetwork
+		}
+		return bender.TagError(class, err)
 	}
+	return err
 }
 
 // DeserializeThriftMessage deserializes a Thrift-encoded byte array.
@@ -0,0 +1,78 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package thrift
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/pinterest/bender"
+)
+
+func TestTagError(t *testing.T) {
+	tagged := bender.TagError(bender.ErrorClassValidation, thrift.NewTProtocolException(errors.New("bad")))
+	for _, tc := range []struct {
+		err   error
+		class bender.ErrorClass
+	}{
+		{thrift.NewTApplicationException(thrift.INTERNAL_ERROR, "internal"), bender.ErrorClassServer},
+		{fmt.Errorf("call: %w", thrift.NewTApplicationException(thrift.UNKNOWN_METHOD, "unknown")), bender.ErrorClassServer},
+		{thrift.NewTProtocolExceptionWithType(thrift.INVALID_DATA, errors.New("invalid")), bender.ErrorClassProtocol},
+		{thrift.NewTTransportException(thrift.TIMED_OUT, "timed out"), bender.ErrorClassTimeout},
+		{thrift.NewTTransportExceptionFromError(os.ErrDeadlineExceeded), bender.ErrorClassTimeout},
+		{thrift.NewTTransportException(thrift.NOT_OPEN, "not open"), bender.ErrorClassNetwork},
+		{thrift.NewTTransportException(thrift.END_OF_FILE, "EOF"), bender.ErrorClassNetwork},
+		{errors.New("other"), bender.ErrorClassOther},
+		{tagged, bender.ErrorClassValidation},
+	} {
+		if class := bender.ClassifyError(tagError(tc.err)); class != tc.class {
+			t.Errorf("Actual(%q) != Expected(%q) for error (%v)", class, tc.class, tc.err)
+		}
+	}
+	if tagError(nil) != nil {
+		t.Error("Expected no error for nil")
+	}
+}
+
+func TestExecutorConnRefused(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	clientExec := func(interface{}, thrift.TTransport) (interface{}, error) {
+		t.Fatal("Expected the client executor not to be called")
+		return nil, nil
+	}
+	res, err := NewThriftRequestExec(thrift.NewTTransportFactory(), clientExec, nil, addr)(0, nil)
+	if class := bender.ClassifyError(err); class != bender.ErrorClassConnRefused {
+		t.Errorf("Actual(%q) != Expected(%q)", class, bender.ErrorClassConnRefused)
+	}
+	if res != nil {
+		t.Errorf("Expected no response, got %+v", res)
+	}
+	res, _ = NewTaggedThriftRequestExec(thrift.NewTTransportFactory(), clientExec, nil, addr)(0, nil)
+	if tr, ok := res.(*bender.TaggedResponse); !ok || tr.Tags[bender.TagTarget] != addr {
+		t.Errorf("Expected a response tagged with the target, got %+v", res)
+	}
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pinterest/bender"
+)
+
+// Span is a client span for a traced request.
+type Span struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// The name of the span, like "GET /users/:id".
+	Name string
+	// The Unix epoch times (in nanoseconds) of the start and end of the request.
+	Start, End int64
+	// The attributes of the span, which are the tags of the request.
+	Attributes map[string]string
+	// The error of the request, if it failed, and its class.
+	Err        error
+	ErrorClass bender.ErrorClass
+}
+
+// Duration returns the latency of the span's request.
+func (s *Span) Duration() time.Duration {
+	return time.Duration(s.End - s.Start)
+}
+
+// The OTLP JSON encoding of spans, as defined by the OTLP protobuf definitions.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		Name              string          `json:"name"`
+		Kind              int             `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue string `json:"stringValue"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+)
+
+// The OTLP span kind and status codes.
+const (
+	otlpKindClient  = 3
+	otlpStatusError = 2
+)
+
+func otlpAttributes(attrs map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	res := make([]otlpAttribute, len(keys))
+	for i, k := range keys {
+		res[i] = otlpAttribute{k, otlpValue{attrs[k]}}
+	}
+	return res
+}
+
+func (s *Span) otlp() otlpSpan {
+	attrs := s.Attributes
+	if s.ErrorClass != "" {
+		attrs = make(map[string]string, len(s.Attributes)+1)
+		for k, v := range s.Attributes {
+			attrs[k] = v
+		}
+		attrs["error.type"] = string(s.ErrorClass)
+	}
+	span := otlpSpan{
+		TraceID:           s.TraceID.String(),
+		SpanID:            s.SpanID.String(),
+		Name:              s.Name,
+		Kind:              otlpKindClient,
+		StartTimeUnixNano: strconv.FormatInt(s.Start, 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.End, 10),
+		Attributes:        otlpAttributes(attrs),
+	}
+	if s.Err != nil {
+		span.Status = otlpStatus{Code: otlpStatusError, Message: s.Err.Error()}
+	}
+	return span
+}
+
+// Exporter exports spans to an OpenTelemetry collector with OTLP over HTTP, in the JSON encoding.
+type Exporter struct {
+	// The URL of the collector's traces endpoint, like "http://localhost:4318/v1/traces".
+	URL string
+	// The service.name attribute of the spans' resource.
+	Service string
+	// The HTTP client used to send the spans.
+	Client *http.Client
+}
+
+// NewExporter creates an Exporter that sends spans to the given URL with the default HTTP client.
+func NewExporter(url, service string) *Exporter {
+	return &Exporter{URL: url, Service: service, Client: http.DefaultClient}
+}
+
+// Export sends the spans to the collector in one request.
+func (e *Exporter) Export(spans []Span) error {
+	scope := otlpScopeSpans{Scope: otlpScope{Name: "github.com/pinterest/bender/trace"}}
+	for i := range spans {
+		scope.Spans = append(scope.Spans, spans[i].otlp())
+	}
+	body, err := json.Marshal(&otlpRequest{[]otlpResourceSpans{{
+		Resource:   otlpResource{otlpAttributes(map[string]string{"service.name": e.Service})},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.Client.Post(e.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("exporting %d spans: %s", len(spans), resp.Status)
+	}
+	return nil
+}
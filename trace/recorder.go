@@ -0,0 +1,161 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trace
+
+import (
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"github.com/pinterest/bender"
+	"github.com/pinterest/bender/hist"
+)
+
+// SpanRecorder creates a span for each traced request from its EndRequestEvent, and exports the
+// spans in batches. It also keeps the slowest traced requests, so that the tail of the latency
+// histogram can be linked to traces. Exporting blocks the recorder, so it is best run with
+// RecordAsync or a FanOut. Its methods are not safe for concurrent use.
+type SpanRecorder struct {
+	exporter *Exporter
+	batch    int
+	keep     int
+	pending  []Span
+	slowest  []Span
+	err      error
+}
+
+// NewSpanRecorder creates a SpanRecorder that exports spans with the exporter in batches of the
+// given size, and after the EndEvent, and keeps the given number of slowest spans.
+func NewSpanRecorder(exporter *Exporter, batch, keep int) *SpanRecorder {
+	return &SpanRecorder{exporter: exporter, batch: batch, keep: keep}
+}
+
+// spanName returns the name of the span for a request with the given tags, which is its HTTP method
+// and route if it has them.
+func spanName(tags map[string]string) string {
+	name := tags[bender.TagMethod]
+	if route := tags[bender.TagRoute]; route != "" {
+		if name != "" {
+			name += " "
+		}
+		name += route
+	}
+	if name == "" {
+		name = "request"
+	}
+	return name
+}
+
+// span returns the span of a request, or false if the request wasn't traced.
+func span(msg *bender.EndRequestEvent) (Span, bool) {
+	s := Span{Name: spanName(msg.Tags), Start: msg.Start, End: msg.End, Err: msg.Err, Attributes: make(map[string]string)}
+	traceID, err := hex.DecodeString(msg.Tags[TagTraceID])
+	if err != nil || len(traceID) != len(s.TraceID) {
+		return s, false
+	}
+	spanID, err := hex.DecodeString(msg.Tags[TagSpanID])
+	if err != nil || len(spanID) != len(s.SpanID) {
+		return s, false
+	}
+	copy(s.TraceID[:], traceID)
+	copy(s.SpanID[:], spanID)
+	for k, v := range msg.Tags {
+		if k != TagTraceID && k != TagSpanID {
+			s.Attributes[k] = v
+		}
+	}
+	if msg.Err != nil {
+		s.ErrorClass = msg.ErrorClass()
+	}
+	return s, true
+}
+
+// Record creates the span of an EndRequestEvent for a traced request.
+func (r *SpanRecorder) Record(msg interface{}) {
+	switch msg := msg.(type) {
+	case *bender.StartEvent:
+		r.slowest = nil
+	case *bender.EndRequestEvent:
+		s, ok := span(msg)
+		if !ok {
+			return
+		}
+		r.pending = append(r.pending, s)
+		r.keepSlowest(s)
+		if len(r.pending) >= r.batch {
+			r.Flush()
+		}
+	case *bender.EndEvent:
+		r.Flush()
+	}
+}
+
+// keepSlowest adds the span to the slowest spans if it is slower than any of them.
+func (r *SpanRecorder) keepSlowest(s Span) {
+	i := sort.Search(len(r.slowest), func(i int) bool {
+		return r.slowest[i].Duration() < s.Duration()
+	})
+	if i >= r.keep {
+		return
+	}
+	r.slowest = append(r.slowest, Span{})
+	copy(r.slowest[i+1:], r.slowest[i:])
+	r.slowest[i] = s
+	if len(r.slowest) > r.keep {
+		r.slowest = r.slowest[:r.keep]
+	}
+}
+
+// Flush exports the pending spans. If the export fails, the spans are dropped.
+func (r *SpanRecorder) Flush() error {
+	if len(r.pending) == 0 {
+		return nil
+	}
+	err := r.exporter.Export(r.pending)
+	if err != nil {
+		r.err = err
+	}
+	r.pending = nil
+	return err
+}
+
+// Err returns the last error encountered while exporting spans, if any.
+func (r *SpanRecorder) Err() error {
+	return r.err
+}
+
+// Slowest returns the slowest spans of the load test, slowest first.
+func (r *SpanRecorder) Slowest() []Span {
+	return r.slowest
+}
+
+// Outliers returns the slowest spans of the load test whose latency is above the given percentile of
+// the histogram, like 0.999, slowest first, so that the tail of the histogram can be looked up in the
+// traces of the service.
+func (r *SpanRecorder) Outliers(h *hist.Histogram, p float64) []Span {
+	if h.Count() == 0 {
+		return nil
+	}
+	threshold := time.Duration(h.InterpolatedPercentiles(p)[0] * float64(h.Scale()))
+	var outliers []Span
+	for _, s := range r.slowest {
+		if s.Duration() > threshold {
+			outliers = append(outliers, s)
+		}
+	}
+	return outliers
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package trace creates OpenTelemetry client spans for a sample of the requests of a load test, so
+// that the slowest requests can be found in the traces of the service under test. NewExecutor wraps a
+// request executor to propagate a W3C traceparent in the sampled requests, and a SpanRecorder turns
+// their EndRequestEvents into spans, which it exports with OTLP over HTTP.
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pinterest/bender"
+)
+
+// Header is the name of the W3C trace context header.
+const Header = "traceparent"
+
+// The tags added to the sampled requests by the executor.
+const (
+	TagTraceID = "trace_id"
+	TagSpanID  = "span_id"
+)
+
+// TraceID is the ID of a trace.
+type TraceID [16]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanID is the ID of a span.
+type SpanID [8]byte
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanContext identifies a span, and is propagated to the service in the traceparent header.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// NewSpanContext returns a sampled SpanContext with random trace and span IDs.
+func NewSpanContext() SpanContext {
+	var sc SpanContext
+	rand.Read(sc.TraceID[:])
+	rand.Read(sc.SpanID[:])
+	sc.Sampled = true
+	return sc
+}
+
+// Traceparent returns the value of the traceparent header for the span.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses the value of a traceparent header.
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, fmt.Errorf("invalid traceparent %q", s)
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return sc, fmt.Errorf("invalid traceparent %q", s)
+	}
+	if err := decodeID(sc.TraceID[:], parts[1]); err != nil {
+		return sc, fmt.Errorf("invalid trace ID in traceparent %q", s)
+	}
+	if err := decodeID(sc.SpanID[:], parts[2]); err != nil {
+		return sc, fmt.Errorf("invalid span ID in traceparent %q", s)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// decodeID decodes a hex ID into dst, which must be exactly filled and not all zeros.
+func decodeID(dst []byte, s string) error {
+	if hex.DecodedLen(len(s)) != len(dst) {
+		return fmt.Errorf("invalid length %d", len(s))
+	}
+	if _, err := hex.Decode(dst, []byte(s)); err != nil {
+		return err
+	}
+	for _, b := range dst {
+		if b != 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("all zero ID")
+}
+
+// An Injector adds a traceparent to a request, and returns the request to send, which may be a copy
+// of the request or a wrapper around it.
+type Injector func(request interface{}, traceparent string) (interface{}, error)
+
+// NewExecutor wraps a request executor to trace the given fraction of the requests, evenly spread
+// over the load test. Each sampled request gets a new trace, which is propagated to the service by
+// the injector, and the response is tagged with the IDs of the trace and of the client span
+// (TagTraceID and TagSpanID), so that a SpanRecorder can create the span from its EndRequestEvent.
+func NewExecutor(exec bender.RequestExecutor, rate float64, inject Injector) bender.RequestExecutor {
+	var n int64
+	return func(t int64, request interface{}) (interface{}, error) {
+		i := atomic.AddInt64(&n, 1)
+		if rate < 1 && math.Floor(float64(i)*rate) == math.Floor(float64(i-1)*rate) {
+			return exec(t, request)
+		}
+
+		sc := NewSpanContext()
+		req, err := inject(request, sc.Traceparent())
+		if err != nil {
+			return nil, err
+		}
+		res, err := exec(t, req)
+		return bender.TagResponse(res, map[string]string{TagTraceID: sc.TraceID.String(), TagSpanID: sc.SpanID.String()}), err
+	}
+}
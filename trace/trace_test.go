@@ -0,0 +1,163 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trace
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pinterest/bender"
+	"github.com/pinterest/bender/hist"
+)
+
+func TestTraceparent(t *testing.T) {
+	sc := NewSpanContext()
+	tp := sc.Traceparent()
+	if len(tp) != 55 || tp[len(tp)-2:] != "01" {
+		t.Errorf("Invalid traceparent %q", tp)
+	}
+	parsed, err := ParseTraceparent(tp)
+	if err != nil || parsed != sc {
+		t.Errorf("Actual(%v, %v) != Expected(%v)", parsed, err, sc)
+	}
+
+	for _, s := range []string{
+		"",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331",
+		"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b71692033-01",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra",
+		"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+	} {
+		if _, err := ParseTraceparent(s); err == nil {
+			t.Errorf("Expected an error for traceparent %q", s)
+		}
+	}
+}
+
+// collector is an in-process stand-in for an OpenTelemetry collector, which keeps the spans it
+// receives.
+type collector struct {
+	mu    sync.Mutex
+	spans []otlpSpan
+	fail  bool
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fail || r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var req otlpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+}
+
+func TestSpanRecorder(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	var headers []string
+	inject := func(request interface{}, traceparent string) (interface{}, error) {
+		headers = append(headers, traceparent)
+		return request, nil
+	}
+	n := 0
+	exec := NewExecutor(func(_ int64, request interface{}) (interface{}, error) {
+		n++
+		time.Sleep(time.Duration(n) * time.Millisecond)
+		tags := map[string]string{bender.TagTarget: "a:80", bender.TagMethod: "GET", bender.TagRoute: "/users/:id"}
+		if n%4 == 0 {
+			return bender.TagResponse(nil, tags), bender.TagError(bender.ErrorClassServer, errors.New("503"))
+		}
+		return bender.TagResponse(n, tags), nil
+	}, 0.5, inject)
+
+	requests := make(chan interface{}, 8)
+	for i := 0; i < 8; i++ {
+		requests <- i
+	}
+	close(requests)
+	ws := bender.NewWorkerSemaphore()
+	go func() { ws.Signal(1) }()
+	recorder := make(chan interface{}, 100)
+	bender.LoadTestConcurrency(ws, requests, exec, recorder)
+
+	h := hist.NewLogHistogram(2, int(time.Microsecond))
+	r := NewSpanRecorder(NewExporter(server.URL+"/v1/traces", "bender-test"), 3, 2)
+	bender.Record(recorder, bender.NewHistogramRecorder(h), r.Record)
+
+	if r.Err() != nil {
+		t.Fatalf("Expected no export error, got %v", r.Err())
+	}
+	if len(headers) != 4 || len(c.spans) != 4 {
+		t.Fatalf("Expected 4 traced requests and spans, got %d and %d", len(headers), len(c.spans))
+	}
+	for i, s := range c.spans {
+		sc, _ := ParseTraceparent(headers[i])
+		if s.TraceID != sc.TraceID.String() || s.SpanID != sc.SpanID.String() {
+			t.Errorf("Span %d has IDs %s-%s, want those of traceparent %q", i, s.TraceID, s.SpanID, headers[i])
+		}
+		if s.Name != "GET /users/:id" || s.Kind != otlpKindClient || len(s.Attributes) < 3 {
+			t.Errorf("Unexpected span %+v", s)
+		}
+	}
+	if failed := c.spans[1]; failed.Status.Code != otlpStatusError || failed.Status.Message != "503" {
+		t.Errorf("Expected the 4th request's span to have an error status, got %+v", failed.Status)
+	}
+
+	slowest := r.Slowest()
+	if len(slowest) != 2 || slowest[0].Duration() < slowest[1].Duration() {
+		t.Fatalf("Expected the 2 slowest spans, slowest first, got %+v", slowest)
+	}
+	if slowest[0].TraceID.String() != c.spans[3].TraceID {
+		t.Errorf("Expected the last request to be the slowest")
+	}
+	outliers := r.Outliers(h, 0.9)
+	if len(outliers) != 1 || outliers[0].TraceID != slowest[0].TraceID {
+		t.Errorf("Expected the slowest span to be the only outlier above p90, got %+v", outliers)
+	}
+}
+
+func TestSpanRecorderExportError(t *testing.T) {
+	server := httptest.NewServer(&collector{fail: true})
+	defer server.Close()
+
+	r := NewSpanRecorder(NewExporter(server.URL+"/v1/traces", "bender-test"), 10, 0)
+	r.Record(&bender.StartEvent{Start: 0})
+	r.Record(&bender.EndRequestEvent{Start: 0, End: 1, Tags: map[string]string{
+		TagTraceID: "0af7651916cd43dd8448eb211c80319c", TagSpanID: "b7ad6b7169203331"}})
+	r.Record(&bender.EndEvent{Start: 0, End: 1})
+	if r.Err() == nil {
+		t.Error("Expected an export error")
+	}
+}
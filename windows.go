@@ -0,0 +1,240 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bender
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/pinterest/bender/hist"
+)
+
+// Window holds the statistics for a fixed window of time in a load test.
+type Window struct {
+	// The Unix epoch times (in nanoseconds) at which the window starts and ends.
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	// The number of requests that ended in the window, and how many of them failed.
+	Requests int `json:"requests"`
+	Errors   int `json:"errors"`
+	// The number of WaitEvents in the window, and the largest overage they reported.
+	Waits      int   `json:"waits"`
+	MaxOverage int64 `json:"max_overage"`
+	// The latencies of the requests that ended in the window.
+	Hist *hist.Histogram `json:"histogram"`
+}
+
+// Elapsed returns the length of the window, which is shorter than the width of the windowed stats
+// for the last window of a load test.
+func (w *Window) Elapsed() time.Duration {
+	return time.Duration(w.End - w.Start)
+}
+
+// QPS returns the throughput (requests per second) in the window.
+func (w *Window) QPS() float64 {
+	if w.End <= w.Start {
+		return 0
+	}
+	return float64(w.Requests) / w.Elapsed().Seconds()
+}
+
+// ErrorPercent returns the percentage of the requests in the window that failed.
+func (w *Window) ErrorPercent() float64 {
+	if w.Requests == 0 {
+		return 0
+	}
+	return float64(w.Errors) / float64(w.Requests) * 100.0
+}
+
+// WindowedStats holds the statistics of a load test in fixed time windows, so that changes during
+// the test, like a 30 second latency spike in an hour-long test, don't vanish in the summary.
+type WindowedStats struct {
+	// The width of each window.
+	Width time.Duration `json:"width"`
+	// The Unix epoch times (in nanoseconds) at which the load test started and ended.
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	// The windows, in order, starting at the start of the load test.
+	Windows []*Window `json:"windows"`
+
+	newHist func() *hist.Histogram
+}
+
+// NewWindowedStats creates an empty WindowedStats with windows of the given width, which uses
+// newHist to create the latency histogram for each window. It panics if the width isn't positive.
+func NewWindowedStats(width time.Duration, newHist func() *hist.Histogram) *WindowedStats {
+	if width <= 0 {
+		panic(fmt.Sprintf("bender: invalid window width %v", width))
+	}
+	return &WindowedStats{Width: width, newHist: newHist}
+}
+
+// window returns the window containing the time t, creating it and any windows before it as needed.
+func (ws *WindowedStats) window(t int64) *Window {
+	i := 0
+	if t > ws.Start {
+		i = int((t - ws.Start) / int64(ws.Width))
+	}
+	for len(ws.Windows) <= i {
+		start := ws.Start + int64(len(ws.Windows))*int64(ws.Width)
+		w := &Window{Start: start, End: start + int64(ws.Width), Hist: ws.newHist()}
+		w.Hist.Start(int(w.Start))
+		w.Hist.End(int(w.End))
+		ws.Windows = append(ws.Windows, w)
+	}
+	return ws.Windows[i]
+}
+
+// Percentiles returns the values of the given percentiles for each window, in the units of the
+// window histograms.
+func (ws *WindowedStats) Percentiles(percentiles ...float64) [][]int {
+	result := make([][]int, len(ws.Windows))
+	for i, w := range ws.Windows {
+		result[i] = w.Hist.Percentiles(append([]float64(nil), percentiles...)...)
+	}
+	return result
+}
+
+// Total returns a histogram of all the requests in the windowed stats, merged from the windows, which
+// covers the whole load test.
+func (ws *WindowedStats) Total() (*hist.Histogram, error) {
+	if len(ws.Windows) == 0 {
+		return nil, errors.New("no windows")
+	}
+	var total *hist.Histogram
+	if ws.newHist != nil {
+		total = ws.newHist()
+	} else {
+		// Windowed stats decoded from JSON have no constructor, so start from a copy of the first
+		// window's histogram instead.
+		data, err := ws.Windows[0].Hist.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		total = &hist.Histogram{}
+		if err := total.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+	}
+	for i, w := range ws.Windows {
+		if i == 0 && ws.newHist == nil {
+			continue
+		}
+		if err := total.Merge(w.Hist); err != nil {
+			return nil, err
+		}
+	}
+	total.Start(int(ws.Start))
+	total.End(int(ws.End))
+	return total, nil
+}
+
+// WriteCSV writes a time series of the windowed stats to w as CSV, with one row for each window and
+// a column for each of the given percentiles, so it can be plotted or imported elsewhere. Times are
+// in seconds from the start of the load test.
+func (ws *WindowedStats) WriteCSV(w io.Writer, percentiles ...float64) error {
+	cw := csv.NewWriter(w)
+	header := []string{"start", "end", "requests", "errors", "qps", "error_percent", "max_overage"}
+	for _, p := range percentiles {
+		header = append(header, hist.PercentileName(p))
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	ps := ws.Percentiles(percentiles...)
+	for i, win := range ws.Windows {
+		row := []string{
+			strconv.FormatFloat(time.Duration(win.Start-ws.Start).Seconds(), 'f', 3, 64),
+			strconv.FormatFloat(time.Duration(win.End-ws.Start).Seconds(), 'f', 3, 64),
+			strconv.Itoa(win.Requests),
+			strconv.Itoa(win.Errors),
+			strconv.FormatFloat(win.QPS(), 'f', 2, 64),
+			strconv.FormatFloat(win.ErrorPercent(), 'f', 2, 64),
+			strconv.FormatInt(win.MaxOverage, 10),
+		}
+		for _, p := range ps[i] {
+			row = append(row, strconv.Itoa(p))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// NewWindowedRecorder creates a new recorder that adds the requests and waits of a load test to the
+// windowed stats. Requests are counted in the window in which they end or, if the load test
+// aggregates the latencies itself, in the window in which their HistogramEvent ends. Events before
+// the StartEvent are ignored, since the windows start at the start of the load test.
+func NewWindowedRecorder(ws *WindowedStats) Recorder {
+	var started, aggregated bool
+	return func(msg interface{}) {
+		if _, ok := msg.(*StartEvent); !ok && !started {
+			return
+		}
+		switch msg := msg.(type) {
+		case *StartEvent:
+			ws.Start = msg.Start
+			ws.Windows = nil
+			started, aggregated = true, msg.Aggregated
+			if ws.newHist != nil {
+				checkAggregated(ws.newHist(), msg)
+			}
+		case *EndEvent:
+			ws.End = msg.End
+			// An end on the boundary of a window ends the previous window, rather than starting an
+			// empty one.
+			t := msg.End
+			if t > ws.Start && (t-ws.Start)%int64(ws.Width) == 0 {
+				t--
+			}
+			w := ws.window(t)
+			w.End = msg.End
+			w.Hist.End(int(msg.End))
+		case *WaitEvent:
+			w := ws.window(msg.Time)
+			w.Waits++
+			if msg.Overage > w.MaxOverage {
+				w.MaxOverage = msg.Overage
+			}
+		case *EndRequestEvent:
+			if aggregated {
+				return
+			}
+			w := ws.window(msg.End)
+			w.Requests++
+			addRequest(w.Hist, msg)
+			if msg.Err != nil {
+				w.Errors++
+			}
+		case *HistogramEvent:
+			w := ws.window(msg.End)
+			w.Requests += msg.Hist.Count()
+			w.Errors += msg.Hist.Errors()
+			mergeAggregated(w.Hist, msg)
+			// Merging extends the histogram's times to the event's, so restore the window's times.
+			w.Hist.Start(int(w.Start))
+			w.Hist.End(int(w.End))
+		}
+	}
+}
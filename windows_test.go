@@ -0,0 +1,140 @@
+/*
+Copyright 2014-2016 Pinterest, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bender
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pinterest/bender/hist"
+)
+
+func newTestWindowedStats() *WindowedStats {
+	ws := NewWindowedStats(time.Second, func() *hist.Histogram { return hist.NewHistogram(1000, int(time.Millisecond)) })
+	r := NewWindowedRecorder(ws)
+	sec := int64(time.Second)
+	ms := int64(time.Millisecond)
+	r(&StartEvent{Start: 0})
+	for i := int64(0); i < 10; i++ {
+		r(&WaitEvent{Overage: i * ms, Time: i * sec / 4})
+		r(&EndRequestEvent{Start: i*sec/4 - 10*ms, End: i * sec / 4})
+	}
+	r(&EndRequestEvent{Start: 2*sec + 100*ms, End: 2*sec + 600*ms, Err: errors.New("fake error")})
+	r(&EndEvent{Start: 0, End: 2*sec + 500*ms + 600*ms})
+	return ws
+}
+
+func TestWindowedRecorder(t *testing.T) {
+	ws := newTestWindowedStats()
+	if len(ws.Windows) != 4 {
+		t.Fatalf("Expected 4 windows, got %d", len(ws.Windows))
+	}
+
+	w := ws.Windows[0]
+	if w.Requests != 4 || w.Errors != 0 || w.QPS() != 4 || w.MaxOverage != int64(3*time.Millisecond) {
+		t.Errorf("Unexpected first window %+v", w)
+	}
+	w = ws.Windows[2]
+	if w.Requests != 3 || w.Errors != 1 || w.ErrorPercent() != float64(1)/float64(3)*100.0 || w.Hist.Percentiles(1.0)[0] != 500 {
+		t.Errorf("Unexpected third window %+v", w)
+	}
+	w = ws.Windows[3]
+	if w.Requests != 0 || w.Elapsed() != 100*time.Millisecond {
+		t.Errorf("Expected an empty, shorter last window, got %+v", w)
+	}
+}
+
+func TestWindowedStatsCSV(t *testing.T) {
+	var b bytes.Buffer
+	if err := newTestWindowedStats().WriteCSV(&b, 0.5, 1.0); err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 5 || lines[0] != "start,end,requests,errors,qps,error_percent,max_overage,p50,p100" {
+		t.Fatalf("Unexpected CSV:\n%s", b.String())
+	}
+	if lines[3] != "2.000,3.000,3,1,3.00,33.33,9000000,10,500" {
+		t.Errorf("Unexpected CSV row %q", lines[3])
+	}
+}
+
+func TestWindowedStatsJSON(t *testing.T) {
+	ws := newTestWindowedStats()
+	data, err := json.Marshal(ws)
+	if err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	var d WindowedStats
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	if len(d.Windows) != 4 || d.Width != time.Second || d.Windows[2].Hist.Percentiles(1.0)[0] != 500 {
+		t.Errorf("Decoded stats %+v != Encoded %+v", d, ws)
+	}
+}
+
+func TestWindowedStatsTotal(t *testing.T) {
+	ws := newTestWindowedStats()
+	data, _ := json.Marshal(ws)
+	var d WindowedStats
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatalf("Expected no error, got (%v)", err)
+	}
+	for _, s := range []*WindowedStats{ws, &d} {
+		total, err := s.Total()
+		if err != nil {
+			t.Fatalf("Expected no error, got (%v)", err)
+		}
+		if total.Count() != 11 || total.Errors() != 1 || total.Max() != 500 {
+			t.Errorf("Unexpected total %v", total)
+		}
+	}
+	if _, err := NewWindowedStats(time.Second, nil).Total(); err == nil {
+		t.Errorf("Expected an error for empty stats")
+	}
+}
+
+func TestWindowedStatsInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic creating windowed stats with a zero width")
+		}
+	}()
+	ws := NewWindowedStats(time.Second, newTestHist)
+	r := NewWindowedRecorder(ws)
+	r(&EndRequestEvent{Start: 0, End: int64(time.Hour)})
+	r(&WaitEvent{Time: int64(time.Hour)})
+	if len(ws.Windows) != 0 {
+		t.Errorf("Expected no windows before the StartEvent, got %d", len(ws.Windows))
+	}
+	NewWindowedStats(0, newTestHist)
+}
+
+func TestWindowedRecorderEndOnBoundary(t *testing.T) {
+	ws := NewWindowedStats(time.Second, newTestHist)
+	r := NewWindowedRecorder(ws)
+	r(&StartEvent{Start: 0})
+	r(&EndRequestEvent{Start: 0, End: int64(time.Second / 2)})
+	r(&EndEvent{Start: 0, End: int64(2 * time.Second)})
+	if len(ws.Windows) != 2 || ws.Windows[1].End != int64(2*time.Second) {
+		t.Errorf("Expected 2 windows ending at the end of the load test, got %d", len(ws.Windows))
+	}
+}